@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WithAdminToken enables the admin routes for requests carrying the token as a bearer
+// token. Without a token the admin routes are disabled.
+func WithAdminToken(token string) ServerOption {
+	return func(s *ApiServer) {
+		s.adminToken = token
+	}
+}
+
+// WithCompactKeepRevisions sets how many of each note's newest revisions compaction keeps.
+func WithCompactKeepRevisions(n int) ServerOption {
+	return func(s *ApiServer) {
+		s.compactKeepRevisions = n
+	}
+}
+
+// WithPurgeAge keeps expired notes in memory until they expired d ago, before the sweeper
+// or compaction removes them. Zero, the default, removes them as soon as they expire.
+func WithPurgeAge(d time.Duration) ServerOption {
+	return func(s *ApiServer) {
+		s.purgeAge = d
+	}
+}
+
+// purgeable reports whether an expired note has been kept long enough to be removed.
+func purgeable(note Note, now time.Time, age time.Duration) bool {
+	return note.expired(now) && now.Sub(*note.ExpiresAt) >= age
+}
+
+// isAdmin reports whether the request carries the admin token.
+func (s *ApiServer) isAdmin(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && s.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) == 1
+}
+
+// adminDenied answers a request to an admin route that isn't authorized. When no admin
+// token is configured the admin routes don't exist at all.
+func (s *ApiServer) adminDenied(w http.ResponseWriter, r *http.Request) error {
+	if s.adminToken == "" {
+		return WriteJSON(r, w, http.StatusNotFound, ApiError{Error: "Not found"})
+	}
+	w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+	return WriteJSON(r, w, http.StatusUnauthorized, ApiError{Error: "admin token required"})
+}
+
+// types
+// -----
+type MemoryStats struct {
+	Notes        int `json:"notes"`
+	ExpiredNotes int `json:"expired_notes"`
+	Drafts       int `json:"drafts"`
+	Revisions    int `json:"revisions"`
+}
+
+type CompactResult struct {
+	RemovedNotes     int `json:"removed_notes"`
+	RemovedDrafts    int `json:"removed_drafts"`
+	TrimmedRevisions int `json:"trimmed_revisions"`
+}
+
+// stats and compaction handlers
+// -----------------------------
+// memoryStatsHandler counts what the store is holding on to. Expired notes, which stand in
+// for soft deleted ones, are the ones the sweeper hasn't removed yet.
+func (s *ApiServer) memoryStatsHandler(w http.ResponseWriter, r *http.Request) error {
+	var stats MemoryStats
+	now := time.Now()
+
+	mu.Lock()
+	for _, note := range notes {
+		if note.expired(now) {
+			stats.ExpiredNotes++
+		} else {
+			stats.Notes++
+		}
+	}
+	for _, revisions := range noteHistory {
+		stats.Revisions += len(revisions)
+	}
+	mu.Unlock()
+
+	draftsMu.Lock()
+	stats.Drafts = len(drafts)
+	draftsMu.Unlock()
+
+	return WriteJSON(r, w, http.StatusOK, stats)
+}
+
+// compactHandler frees memory without waiting for the sweeper: it removes expired notes
+// and stale drafts, and trims each note's history to its newest revisions (?keep=n, or
+// the configured default). Trimming renumbers the kept revisions from 1.
+//
+// There is no soft delete; an expired note stands in for one, since it is gone for
+// clients but still held in memory for the purge age. Compaction removes the notes that
+// expired at least ?older_than= ago, or the purge age, without waiting for the sweeper.
+func (s *ApiServer) compactHandler(w http.ResponseWriter, r *http.Request) error {
+	if !s.isAdmin(r) {
+		return s.adminDenied(w, r)
+	}
+
+	keep := s.compactKeepRevisions
+	if v := r.URL.Query().Get("keep"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: "keep must be a positive number"})
+		}
+		keep = n
+	}
+	age := s.purgeAge
+	if v := r.URL.Query().Get("older_than"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: "older_than must be a duration like 24h"})
+		}
+		age = d
+	}
+
+	var result CompactResult
+	removed := make([]string, 0)
+	now := time.Now()
+	dryRun := isDryRun(r)
+
+	mu.Lock()
+	for id, note := range notes {
+		if purgeable(note, now, age) {
+			removed = append(removed, id)
+		}
+	}
+	result.RemovedNotes = len(removed)
+	for id, revisions := range noteHistory {
+		if extra := len(revisions) - keep; extra > 0 {
+			result.TrimmedRevisions += extra
+			if !dryRun {
+				noteHistory[id] = append([]Note(nil), revisions[extra:]...)
+			}
+		}
+	}
+	if !dryRun {
+		for _, id := range removed {
+			removeNote(id)
+		}
+	}
+	mu.Unlock()
+
+	if dryRun {
+		result.RemovedDrafts = s.staleDrafts(now)
+		return writeDryRun(w, r, DryRunPlan{Action: "compact", Count: len(removed), IDs: removed, Details: result})
+	}
+
+	result.RemovedDrafts = s.sweepDrafts(now)
+
+	return WriteJSON(r, w, http.StatusOK, result)
+}
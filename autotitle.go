@@ -0,0 +1,24 @@
+package main
+
+import "strings"
+
+// maxAutoTitleLength is the most characters a title derived from the content keeps.
+const maxAutoTitleLength = 80
+
+// WithAutoTitle gives notes created without a title one taken from their content.
+func WithAutoTitle(auto bool) ServerOption {
+	return func(s *ApiServer) {
+		s.autoTitle = auto
+	}
+}
+
+// titleFromContent returns the first non-blank line of content as plain text, cut to
+// maxAutoTitleLength characters. It is empty when the content is.
+func titleFromContent(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		if title := snippet(line, maxAutoTitleLength); title != "" {
+			return title
+		}
+	}
+	return ""
+}
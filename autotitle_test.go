@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTitleFromContent(t *testing.T) {
+	long := strings.Repeat("word ", 40)
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"first line", "Shopping\nmilk\neggs", "Shopping"},
+		{"skips blank lines", "\n   \n\tShopping\nmilk", "Shopping"},
+		{"collapses whitespace", "  Big    plans\t today ", "Big plans today"},
+		{"drops html tags", "<b>Bold</b> <i>move</i>", "Bold move"},
+		{"empty", "", ""},
+		{"only blank lines", "\n \n\t", ""},
+		{"truncated with an ellipsis", long, strings.TrimSpace(long[:maxAutoTitleLength-1]) + "…"},
+		{"exactly the limit", strings.Repeat("a", maxAutoTitleLength), strings.Repeat("a", maxAutoTitleLength)},
+		{"counts characters, not bytes", strings.Repeat("é", maxAutoTitleLength), strings.Repeat("é", maxAutoTitleLength)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := titleFromContent(tt.content)
+			if got != tt.want {
+				t.Errorf("titleFromContent(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+			if n := utf8.RuneCountInString(got); n > maxAutoTitleLength {
+				t.Errorf("title has %d characters, the limit is %d", n, maxAutoTitleLength)
+			}
+		})
+	}
+}
+
+func TestCreateNoteAutoTitle(t *testing.T) {
+	tests := []struct {
+		name string
+		auto bool
+		body string
+		want int
+		// title is the stored title, when the note is created
+		title string
+	}{
+		{"derived", true, "title=&content=First+line%0Asecond", http.StatusFound, "First line"},
+		{"given title wins", true, "title=Mine&content=First+line", http.StatusFound, "Mine"},
+		{"blank title is derived", true, "title=+++&content=First+line", http.StatusFound, "First line"},
+		{"nothing to derive from", true, "title=&content=", http.StatusBadRequest, ""},
+		{"off", false, "title=&content=First+line", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t, WithAutoTitle(tt.auto))
+			w := serve(h, "POST", "/notes", tt.body, "Content-Type", "application/x-www-form-urlencoded")
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want != http.StatusFound {
+				return
+			}
+			if got := notes[w.Header().Get("X-Note-ID")].Title; got != tt.title {
+				t.Errorf("title = %q, want %q", got, tt.title)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backup files are named notes-<UTC time>.json, so sorting the names sorts them by age
+const (
+	backupPrefix     = "notes-"
+	backupSuffix     = ".json"
+	backupTimeFormat = "20060102T150405Z"
+)
+
+// WithBackups writes every note to a timestamped JSON file in dir each interval, in the
+// same format as /export so a backup can be fed back through /import (encrypted ones
+// after -decrypt-backup). Only the newest keep backups are kept, or all of them if keep
+// is 0. Zero interval, the default, takes no backups.
+func WithBackups(dir string, interval time.Duration, keep int) ServerOption {
+	return func(s *ApiServer) {
+		s.backupDir = dir
+		s.backupInterval = interval
+		s.backupKeep = keep
+	}
+}
+
+// backupNotes takes a backup every backup interval until the server stops.
+func (s *ApiServer) backupNotes() {
+	ticker := time.NewTicker(s.backupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		case now := <-ticker.C:
+			path, count, err := s.backup(now)
+			if err != nil {
+				log.Printf("backup: %s", err)
+				continue
+			}
+			log.Printf("backup: wrote %d notes to %s", count, path)
+
+			if err := s.pruneBackups(); err != nil {
+				log.Printf("backup: pruning: %s", err)
+			}
+		}
+	}
+}
+
+// backup writes the notes to a new backup file and returns its path and how many notes
+// it holds. The file store renames a finished file into place, so a crash halfway
+// through never leaves a truncated backup behind.
+func (s *ApiServer) backup(now time.Time) (string, int, error) {
+	if err := os.MkdirAll(s.backupDir, 0o755); err != nil {
+		return "", 0, err
+	}
+
+	list := exportedNotes(now)
+	path := filepath.Join(s.backupDir, backupPrefix+now.UTC().Format(backupTimeFormat)+backupSuffix)
+
+	var dst NoteStore = &fileStore{path: path}
+	if s.backupPassphrase != "" {
+		dst = NewEncryptedStore(dst, s.backupPassphrase, s.backupEncryptTitles)
+	}
+	err := dst.WithTx(func(tx Tx) error {
+		for _, note := range list {
+			tx.Put(note)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return path, len(list), nil
+}
+
+// pruneBackups deletes all but the newest backups. Other files in the directory are
+// left alone.
+func (s *ApiServer) pruneBackups() error {
+	entries, err := os.ReadDir(s.backupDir)
+	if err != nil {
+		return err
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, backupPrefix) && strings.HasSuffix(name, backupSuffix) {
+			backups = append(backups, name)
+		}
+	}
+	if s.backupKeep <= 0 || len(backups) <= s.backupKeep {
+		return nil
+	}
+
+	sort.Strings(backups)
+	for _, name := range backups[:len(backups)-s.backupKeep] {
+		if err := os.Remove(filepath.Join(s.backupDir, name)); err != nil {
+			return err
+		}
+		log.Printf("backup: removed %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// types
+// -----
+type BatchOp struct {
+	Op      string `json:"op"`
+	ID      string `json:"id,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type BatchResult struct {
+	Op     string `json:"op"`
+	ID     string `json:"id,omitempty"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// maxBatchOps is the most operations one batch may carry.
+const maxBatchOps = 100
+
+// batch handler
+// -------------
+// batchHandler applies a list of operations to the notes in a single round trip.
+//
+// Partial failure semantics:
+//   - the whole batch is validated before anything is applied. If any op is malformed
+//     (unknown op, missing id, invalid note) the request is rejected with a 400 and no
+//     changes are made.
+//   - valid ops are then applied in order under one lock. An op that fails at apply time
+//     (e.g. updating a note that does not exist, or one that is locked for editing) is
+//     reported in its result with a 404 or 423, and the remaining ops are still applied.
+//     Nothing is rolled back.
+//   - with ?atomic=true the batch is all or nothing instead: if any op fails, none of the
+//     ops are applied and the response is a 409 with the results, including the failures.
+//   - with ?dry_run=true nothing is applied either way; the response is the plan, with the
+//     results the batch would have had as its details.
+//
+// Otherwise the response is a 200 with one result per op, in the same order as the request.
+// A batch of more than maxBatchOps ops is a 400, and a body larger than that many notes
+// could be a 413, so a batch can't make the server buffer any amount of JSON.
+func (s *ApiServer) batchHandler(w http.ResponseWriter, r *http.Request) error {
+	var ops []BatchOp
+	body := http.MaxBytesReader(nil, r.Body, s.maxNoteBody()*maxBatchOps)
+	if err := json.NewDecoder(body).Decode(&ops); err != nil {
+		return WriteJSON(r, w, decodeStatus(err), ApiError{Error: "invalid batch: " + err.Error()})
+	}
+	if len(ops) > maxBatchOps {
+		return WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: fmt.Sprintf("too many ops: %d, the limit is %d", len(ops), maxBatchOps)})
+	}
+
+	for i := range ops {
+		ops[i] = s.prepareBatchOp(ops[i])
+		if err := s.validateBatchOp(ops[i]); err != nil {
+			return WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: fmt.Sprintf("op %d: %s", i, err)})
+		}
+	}
+
+	atomic := r.URL.Query().Get("atomic") == "true"
+	dryRun := isDryRun(r)
+
+	results := make([]BatchResult, 0, len(ops))
+	failed := false
+	err := store.WithTx(func(tx Tx) error {
+		for _, op := range ops {
+			result := s.applyBatchOp(tx, op)
+			failed = failed || result.Error != ""
+			results = append(results, result)
+		}
+		// a dry run works out every result, then throws the changes away
+		if dryRun || (atomic && failed) {
+			return errRollback
+		}
+		return nil
+	})
+	if dryRun && errors.Is(err, errRollback) {
+		return writeDryRun(w, r, batchPlan(results, atomic && failed))
+	}
+	if errors.Is(err, errRollback) {
+		return WriteJSON(r, w, http.StatusConflict, results)
+	}
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(r, w, http.StatusOK, results)
+}
+
+// batchPlan describes what a batch would change: the notes its successful ops would touch,
+// or nothing when an atomic batch would roll back.
+func batchPlan(results []BatchResult, rolledBack bool) DryRunPlan {
+	plan := DryRunPlan{Action: "batch", IDs: make([]string, 0), Details: results}
+	if rolledBack {
+		return plan
+	}
+	for _, result := range results {
+		if result.Error == "" {
+			plan.Count++
+			plan.IDs = append(plan.IDs, result.ID)
+		}
+	}
+	return plan
+}
+
+// prepareBatchOp cleans up an op's title and content the way decodeNote and createNote
+// do for a note sent on its own.
+func (s *ApiServer) prepareBatchOp(op BatchOp) BatchOp {
+	op.Title, op.Content = sanitizeContent(op.Title), sanitizeContent(op.Content)
+	if s.trimContent {
+		op.Title, op.Content = strings.TrimSpace(op.Title), strings.TrimSpace(op.Content)
+	}
+	if op.Op == "create" && s.autoTitle && strings.TrimSpace(op.Title) == "" {
+		op.Title = titleFromContent(op.Content)
+	}
+	return op
+}
+
+func (s *ApiServer) validateBatchOp(op BatchOp) error {
+	switch op.Op {
+	case "create":
+		return s.validateNote(Note{Title: op.Title, Content: op.Content})
+	case "update":
+		if op.ID == "" {
+			return fmt.Errorf("update requires an id")
+		}
+		return s.validateNote(Note{Title: op.Title, Content: op.Content})
+	case "delete":
+		if op.ID == "" {
+			return fmt.Errorf("delete requires an id")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown op: %q", op.Op)
+	}
+}
+
+// applyBatchOp applies a single validated op to tx. The caller must hold mu.
+func (s *ApiServer) applyBatchOp(tx Tx, op BatchOp) BatchResult {
+	switch op.Op {
+	case "create":
+		if s.atNoteLimit(tx.Count()) {
+			return BatchResult{Op: op.Op, Status: http.StatusInsufficientStorage, Error: errNoteLimit(s.maxTotalNotes).Error()}
+		}
+		id := s.generateID()
+		tx.Put(Note{
+			ID:      id,
+			Title:   op.Title,
+			Content: op.Content,
+			Created: time.Now(),
+			Tags:    s.withDefaultTags(nil),
+		})
+		return BatchResult{Op: op.Op, ID: id, Status: http.StatusCreated}
+
+	case "update":
+		note, exists := tx.Get(op.ID)
+		if !exists {
+			return BatchResult{Op: op.Op, ID: op.ID, Status: http.StatusNotFound, Error: "Note not found"}
+		}
+		if note.Locked {
+			return BatchResult{Op: op.Op, ID: op.ID, Status: http.StatusForbidden, Error: errReadOnly}
+		}
+		// a batch carries no lock token, so it cannot update a note someone is editing
+		if _, held := s.activeLock(op.ID); held {
+			return BatchResult{Op: op.Op, ID: op.ID, Status: http.StatusLocked, Error: "Note is locked by another editor"}
+		}
+		// everything but the title and content is kept; the content changes, so the note
+		// is no longer trusted
+		updated := note.clone()
+		updated.Title = op.Title
+		updated.Content = op.Content
+		updated.Trusted = false
+		tx.Put(updated)
+		return BatchResult{Op: op.Op, ID: op.ID, Status: http.StatusOK}
+
+	default: // delete
+		note, exists := tx.Get(op.ID)
+		if !exists {
+			return BatchResult{Op: op.Op, ID: op.ID, Status: http.StatusNotFound, Error: "Note not found"}
+		}
+		if note.Locked {
+			return BatchResult{Op: op.Op, ID: op.ID, Status: http.StatusForbidden, Error: errReadOnly}
+		}
+		tx.Delete(op.ID)
+		return BatchResult{Op: op.Op, ID: op.ID, Status: http.StatusOK}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBatchLimits(t *testing.T) {
+	// ops returns a batch of n creates
+	ops := func(n int) string {
+		op := `{"op": "create", "title": "t", "content": "c"}`
+		return "[" + strings.TrimSuffix(strings.Repeat(op+",", n), ",") + "]"
+	}
+
+	tests := []struct {
+		name  string
+		body  string
+		want  int
+		notes int
+	}{
+		{"at the op limit", ops(maxBatchOps), http.StatusOK, maxBatchOps},
+		{"too many ops", ops(maxBatchOps + 1), http.StatusBadRequest, 0},
+		{"oversized body", `[{"op": "create", "title": "t", "content": "` + strings.Repeat("a", 7<<20) + `"}]`, http.StatusRequestEntityTooLarge, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// with content of at most 10 characters, a batch body can't reach 7MiB
+			_, h := newTestServer(t, WithMaxContentLength(10))
+			w := serve(h, "POST", "/api/batch", tt.body, "Content-Type", "application/json")
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %.200s", w.Code, tt.want, w.Body)
+			}
+			if len(notes) != tt.notes {
+				t.Errorf("%d notes stored, want %d", len(notes), tt.notes)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// WithChaos makes a fraction rate of requests sleep a random time up to maxDelay before
+// they are handled, and a fraction errorRate of those fail with a 500 instead. It exists
+// to test how clients cope with a slow or flaky server and must never be on in production.
+func WithChaos(rate float64, maxDelay time.Duration, errorRate float64) ServerOption {
+	return func(s *ApiServer) {
+		s.chaosRate = rate
+		s.chaosDelay = maxDelay
+		s.chaosErrorRate = errorRate
+	}
+}
+
+// withChaos injects the delays and failures configured by WithChaos. Without a delay it
+// does nothing, so the default server never pays for it.
+func (s *ApiServer) withChaos(next http.Handler) http.Handler {
+	if s.chaosDelay <= 0 || s.chaosRate <= 0 {
+		return next
+	}
+
+	log.Printf("WARN chaos mode: delaying %.0f%% of requests by up to %s, failing %.0f%% of those",
+		s.chaosRate*100, s.chaosDelay, s.chaosErrorRate*100)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rand.Float64() >= s.chaosRate {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		select {
+		case <-time.After(time.Duration(rand.Int63n(int64(s.chaosDelay)))):
+		case <-r.Context().Done():
+			return
+		}
+
+		if rand.Float64() < s.chaosErrorRate {
+			if wantsJSON(r) {
+				WriteBytes(w, http.StatusInternalServerError, "application/json", []byte(`{"error":"chaos mode failure"}`+"\n"))
+				return
+			}
+			http.Error(w, "chaos mode failure", http.StatusInternalServerError)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
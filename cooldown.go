@@ -0,0 +1,79 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// when each session last created a note, keyed by session id. They have their own lock;
+// when both are needed, take mu first.
+var (
+	lastCreates   = make(map[string]time.Time)
+	lastCreatesMu = &sync.Mutex{}
+)
+
+// WithCreateCooldown makes a browser session wait at least d between creating notes, to
+// slow down spam from a single session. Zero turns the cooldown off.
+func WithCreateCooldown(d time.Duration) ServerOption {
+	return func(s *ApiServer) {
+		s.createCooldown = d
+	}
+}
+
+// cooldownLeft returns the session of the request, starting one if needed, and how long
+// it still has to wait before it may create another note. The session is "" when there
+// is no cooldown.
+func (s *ApiServer) cooldownLeft(w http.ResponseWriter, r *http.Request) (string, time.Duration, error) {
+	if s.createCooldown <= 0 {
+		return "", 0, nil
+	}
+	session, err := ensureSession(w, r)
+	if err != nil {
+		return "", 0, err
+	}
+
+	lastCreatesMu.Lock()
+	defer lastCreatesMu.Unlock()
+
+	last, ok := lastCreates[session]
+	if !ok {
+		return session, 0, nil
+	}
+	return session, max(s.createCooldown-time.Since(last), 0), nil
+}
+
+// recordCreate starts a session's cooldown after it created a note.
+func recordCreate(session string) {
+	if session == "" {
+		return
+	}
+	lastCreatesMu.Lock()
+	lastCreates[session] = time.Now()
+	lastCreatesMu.Unlock()
+}
+
+// sweepCreates forgets the sessions whose cooldown is over.
+func (s *ApiServer) sweepCreates(now time.Time) {
+	lastCreatesMu.Lock()
+	defer lastCreatesMu.Unlock()
+
+	for session, last := range lastCreates {
+		if now.Sub(last) >= s.createCooldown {
+			delete(lastCreates, session)
+		}
+	}
+}
+
+// tooSoon tells a session it has to wait before creating another note.
+func (s *ApiServer) tooSoon(w http.ResponseWriter, r *http.Request, wait time.Duration) error {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	message := "You are creating notes too quickly, try again in " + wait.Round(time.Millisecond).String()
+
+	if wantsJSON(r) {
+		return WriteJSON(r, w, http.StatusTooManyRequests, ApiError{Error: message})
+	}
+	return WriteHTML(w, http.StatusTooManyRequests, templates, "error.html", s.errorPage(message))
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultPageSize is how many notes a page holds when ?cursor= comes without ?limit=
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var errInvalidCursor = errors.New("invalid cursor, start again without one")
+
+// NotePage is a page of the JSON list, with the cursor of the next page if there is one.
+type NotePage struct {
+	Notes      []any  `json:"notes"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// pageRequest is a request for one page of the list, newest first: up to limit notes
+// that come after the note the cursor was made from.
+type pageRequest struct {
+	limit int
+
+	// the position of the last note of the previous page, zero for the first page
+	created time.Time
+	id      string
+}
+
+// parsePage reads ?limit= and ?cursor= from the query. It reports false when the request
+// asks for neither, i.e. for the whole list.
+func parsePage(r *http.Request) (pageRequest, bool, error) {
+	q := r.URL.Query()
+	limit, cursor := q.Get("limit"), q.Get("cursor")
+	if limit == "" && cursor == "" {
+		return pageRequest{}, false, nil
+	}
+
+	page := pageRequest{limit: defaultPageSize}
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxPageSize {
+			return pageRequest{}, false, errors.New("limit must be a number from 1 to " + strconv.Itoa(maxPageSize))
+		}
+		page.limit = n
+	}
+	if cursor != "" {
+		created, id, err := decodeCursor(cursor)
+		if err != nil {
+			return pageRequest{}, false, err
+		}
+		page.created, page.id = created, id
+	}
+	return page, true, nil
+}
+
+// encodeCursor returns the opaque cursor for the page after note. It is the note's
+// position in the list rather than an offset, so notes added or removed before it don't
+// shift the next page.
+func encodeCursor(note Note) string {
+	raw := strconv.FormatInt(note.Created.UnixNano(), 10) + "." + note.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", errInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(string(raw), ".")
+	if !ok || !isValidID(id) {
+		return time.Time{}, "", errInvalidCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, "", errInvalidCursor
+	}
+	return time.Unix(0, n), id, nil
+}
+
+// sortForPaging orders notes newest first, with ties broken by ID, so every note has one
+// fixed position for a cursor to point at.
+func sortForPaging(list []Note) {
+	sort.Slice(list, func(i, j int) bool { return pagedBefore(list[i], list[j].Created, list[j].ID) })
+}
+
+// pagedBefore reports whether note comes before the position (created, id) in paging order.
+func pagedBefore(note Note, created time.Time, id string) bool {
+	if !note.Created.Equal(created) {
+		return note.Created.After(created)
+	}
+	return note.ID > id
+}
+
+// page returns the notes of list, sorted by sortForPaging, that the page asks for, and
+// the cursor of the next page, empty on the last one.
+func (p pageRequest) page(list []Note) ([]Note, string) {
+	start := 0
+	if p.id != "" {
+		start = sort.Search(len(list), func(i int) bool {
+			return !pagedBefore(list[i], p.created, p.id) && !(list[i].Created.Equal(p.created) && list[i].ID == p.id)
+		})
+	}
+
+	list = list[start:]
+	if len(list) <= p.limit {
+		return list, ""
+	}
+	list = list[:p.limit]
+	return list, encodeCursor(list[len(list)-1])
+}
+
+// nextPageURL is the list URL for the page at cursor, keeping the request's other parameters.
+func nextPageURL(r *http.Request, cursor string) string {
+	q := r.URL.Query()
+	q.Set("cursor", cursor)
+	return r.URL.Path + "?" + q.Encode()
+}
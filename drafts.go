@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// types
+// -----
+// Draft is an in-progress edit of a note, autosaved by the edit form.
+type Draft struct {
+	Title   string    `json:"title"`
+	Content string    `json:"content"`
+	Saved   time.Time `json:"saved"`
+}
+
+// drafts keyed by note ID. They have their own lock so autosaves don't contend with
+// the notes; when both are needed, take mu first.
+var (
+	drafts   = make(map[string]Draft)
+	draftsMu = &sync.Mutex{}
+)
+
+// WithDraftTimeout sets how long a draft survives without being saved again.
+func WithDraftTimeout(d time.Duration) ServerOption {
+	return func(s *ApiServer) {
+		s.draftTimeout = d
+	}
+}
+
+func clearDraft(id string) {
+	draftsMu.Lock()
+	delete(drafts, id)
+	draftsMu.Unlock()
+}
+
+// sweepDrafts drops drafts nobody has saved within the draft timeout and returns how many.
+func (s *ApiServer) sweepDrafts(now time.Time) int {
+	draftsMu.Lock()
+	defer draftsMu.Unlock()
+
+	removed := 0
+	for id, draft := range drafts {
+		if now.Sub(draft.Saved) >= s.draftTimeout {
+			delete(drafts, id)
+			removed++
+		}
+	}
+	return removed
+}
+
+// staleDrafts counts the drafts sweepDrafts would drop.
+func (s *ApiServer) staleDrafts(now time.Time) int {
+	draftsMu.Lock()
+	defer draftsMu.Unlock()
+
+	stale := 0
+	for _, draft := range drafts {
+		if now.Sub(draft.Saved) >= s.draftTimeout {
+			stale++
+		}
+	}
+	return stale
+}
+
+// draft handlers
+// --------------
+func (s *ApiServer) saveDraft(w http.ResponseWriter, r *http.Request) error {
+	id := extractID(r.URL.Path)
+
+	input, err := s.decodeNote(r)
+	if err != nil {
+		return WriteJSON(r, w, decodeStatus(err), ApiError{Error: err.Error()})
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, exists := notes[id]; !exists {
+		return WriteJSON(r, w, http.StatusNotFound, ApiError{Error: "Note not found"})
+	}
+
+	draft := Draft{Title: input.Title, Content: input.Content, Saved: time.Now()}
+
+	draftsMu.Lock()
+	drafts[id] = draft
+	draftsMu.Unlock()
+
+	return WriteJSON(r, w, http.StatusOK, draft)
+}
+
+func (s *ApiServer) getDraft(w http.ResponseWriter, r *http.Request) error {
+	id := extractID(r.URL.Path)
+
+	draftsMu.Lock()
+	draft, exists := drafts[id]
+	draftsMu.Unlock()
+
+	if !exists || time.Since(draft.Saved) >= s.draftTimeout {
+		return WriteJSON(r, w, http.StatusNotFound, ApiError{Error: "Draft not found"})
+	}
+
+	return WriteJSON(r, w, http.StatusOK, draft)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+type DrainStatus struct {
+	Draining bool `json:"draining"`
+	// Since is when draining started
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// WithDrainDelay makes shutdown drain first: /readyz turns 503 and the server keeps
+// serving for delay, so the load balancer stops sending traffic before the listener
+// closes. Time already spent draining through /admin/drain counts towards it. Zero, the
+// default, shuts down straight away.
+func WithDrainDelay(delay time.Duration) ServerOption {
+	return func(s *ApiServer) {
+		s.drainDelay = delay
+	}
+}
+
+// drain marks the server not ready, if it isn't already draining, and returns when it
+// started draining.
+func (s *ApiServer) drain() time.Time {
+	s.drainedAt.CompareAndSwap(0, time.Now().UnixNano())
+	return time.Unix(0, s.drainedAt.Load())
+}
+
+// drainStatus returns whether the server is draining, and since when.
+func (s *ApiServer) drainStatus() DrainStatus {
+	at := s.drainedAt.Load()
+	if at == 0 {
+		return DrainStatus{}
+	}
+	since := time.Unix(0, at)
+	return DrainStatus{Draining: true, Since: &since}
+}
+
+// waitDrained drains and waits until the server has been draining for the drain delay,
+// or until ctx is done.
+func (s *ApiServer) waitDrained(ctx context.Context) {
+	if s.drainDelay <= 0 {
+		return
+	}
+	wait := s.drainDelay - time.Since(s.drain())
+	if wait <= 0 {
+		return
+	}
+
+	log.Printf("draining for %s before shutting down", wait.Round(time.Millisecond))
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// drain handler
+// -------------
+// drainHandler is for orchestrators' pre-stop hooks. POST starts draining: /readyz
+// answers 503 so the load balancer takes the server out of rotation, while every request
+// that still arrives, on new or existing connections, is served as usual. DELETE makes
+// the server ready again, unless it is already shutting down. GET reports the state.
+func (s *ApiServer) drainHandler(w http.ResponseWriter, r *http.Request) error {
+	if !s.isAdmin(r) {
+		return s.adminDenied(w, r)
+	}
+
+	switch r.Method {
+	case "POST":
+		if s.drainStatus().Draining {
+			break
+		}
+		s.drain()
+		log.Println("draining, /readyz now answers 503")
+	case "DELETE":
+		if s.stopping.Load() {
+			return WriteJSON(r, w, http.StatusConflict, ApiError{Error: "the server is shutting down"})
+		}
+		if s.drainedAt.Swap(0) != 0 {
+			log.Println("no longer draining, /readyz answers 200 again")
+		}
+	}
+	return WriteJSON(r, w, http.StatusOK, s.drainStatus())
+}
@@ -0,0 +1,30 @@
+package main
+
+import "net/http"
+
+// DryRunPlan is what a destructive request would have done, returned instead of doing it
+// when the request asks for ?dry_run=true.
+type DryRunPlan struct {
+	DryRun bool     `json:"dry_run"`
+	Action string   `json:"action"`
+	Count  int      `json:"count"`
+	IDs    []string `json:"ids"`
+
+	// Details is the response the request would have had, for actions that have one
+	Details any `json:"details,omitempty"`
+}
+
+// isDryRun reports whether a destructive request only wants to see what it would affect.
+func isDryRun(r *http.Request) bool {
+	return r.URL.Query().Get("dry_run") == "true"
+}
+
+// writeDryRun answers a dry run with its plan. Dry runs are for scripts, so the plan is
+// always JSON.
+func writeDryRun(w http.ResponseWriter, r *http.Request, plan DryRunPlan) error {
+	plan.DryRun = true
+	if plan.IDs == nil {
+		plan.IDs = []string{}
+	}
+	return WriteJSON(r, w, http.StatusOK, plan)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// encryptedPrefix marks a field sealed by noteCipher. The rest is the base64 salt the key
+// was derived with and the base64 nonce and ciphertext, separated by a colon.
+const encryptedPrefix = "enc:v1:"
+
+// scrypt parameters, the ones its documentation recommends for interactive use
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptSalt   = 16
+	backupKeyLen = 32 // AES-256
+)
+
+var errNoPassphrase = errors.New("the backup is encrypted, give its passphrase with -backup-passphrase")
+
+// WithBackupEncryption writes backups through an EncryptedStore, which encrypts the
+// content and tags of every note, and its title too with titles, using AES-GCM under a
+// key derived from passphrase with scrypt. An empty passphrase, the default, writes
+// backups in the clear.
+func WithBackupEncryption(passphrase string, titles bool) ServerOption {
+	return func(s *ApiServer) {
+		s.backupPassphrase = passphrase
+		s.backupEncryptTitles = titles
+	}
+}
+
+// noteCipher seals and opens note fields with one passphrase derived key. Deriving a key
+// is deliberately slow, so a backup derives one, with a fresh salt, for all its notes.
+type noteCipher struct {
+	salt []byte
+	aead cipher.AEAD
+}
+
+func newNoteCipher(passphrase string, salt []byte) (*noteCipher, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, backupKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &noteCipher{salt: salt, aead: aead}, nil
+}
+
+// newBackupCipher returns a cipher for one backup, with a new random salt.
+func newBackupCipher(passphrase string) (*noteCipher, error) {
+	salt := make([]byte, scryptSalt)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return newNoteCipher(passphrase, salt)
+}
+
+// seal encrypts a field. The note id and field name are authenticated along with it, so
+// a sealed value can't be moved to another note or field without failing to open.
+func (c *noteCipher) seal(plain, id, field string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plain), []byte(id+"/"+field))
+	return encryptedPrefix + base64.RawStdEncoding.EncodeToString(c.salt) + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// encryptNote seals note's content and tags, and its title if titles is set. The tags are
+// sealed together, as one JSON array in a single tag, so not even their number shows.
+func (c *noteCipher) encryptNote(note Note, titles bool) (Note, error) {
+	var err error
+	if note.Content, err = c.seal(note.Content, note.ID, "content"); err != nil {
+		return Note{}, err
+	}
+	if titles {
+		if note.Title, err = c.seal(note.Title, note.ID, "title"); err != nil {
+			return Note{}, err
+		}
+	}
+	if len(note.Tags) > 0 {
+		tags, err := json.Marshal(note.Tags)
+		if err != nil {
+			return Note{}, err
+		}
+		sealed, err := c.seal(string(tags), note.ID, "tags")
+		if err != nil {
+			return Note{}, err
+		}
+		note.Tags = []string{sealed}
+	}
+	return note, nil
+}
+
+// backupKeys opens sealed fields, deriving the key for each salt it meets only once.
+type backupKeys struct {
+	passphrase string
+	ciphers    map[string]*noteCipher
+}
+
+// open decrypts value if it was sealed, and returns it unchanged otherwise.
+func (k *backupKeys) open(value, id, field string) (string, error) {
+	rest, sealed := strings.CutPrefix(value, encryptedPrefix)
+	if !sealed {
+		return value, nil
+	}
+	if k.passphrase == "" {
+		return "", errNoPassphrase
+	}
+
+	encodedSalt, encodedData, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", errors.New("malformed encrypted field")
+	}
+	c, ok := k.ciphers[encodedSalt]
+	if !ok {
+		salt, err := base64.RawStdEncoding.DecodeString(encodedSalt)
+		if err != nil {
+			return "", fmt.Errorf("malformed encrypted field: %w", err)
+		}
+		if c, err = newNoteCipher(k.passphrase, salt); err != nil {
+			return "", err
+		}
+		k.ciphers[encodedSalt] = c
+	}
+
+	data, err := base64.RawStdEncoding.DecodeString(encodedData)
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted field: %w", err)
+	}
+	if len(data) < c.aead.NonceSize() {
+		return "", errors.New("malformed encrypted field")
+	}
+	nonce, ciphertext := data[:c.aead.NonceSize()], data[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, ciphertext, []byte(id+"/"+field))
+	if err != nil {
+		// a wrong passphrase and tampering look the same to GCM
+		return "", errors.New("wrong passphrase, or the backup was modified")
+	}
+	return string(plain), nil
+}
+
+// openNote opens every sealed field of note.
+func (k *backupKeys) openNote(note Note) (Note, error) {
+	var err error
+	if note.Title, err = k.open(note.Title, note.ID, "title"); err != nil {
+		return Note{}, fmt.Errorf("note %s: title: %w", note.ID, err)
+	}
+	if note.Content, err = k.open(note.Content, note.ID, "content"); err != nil {
+		return Note{}, fmt.Errorf("note %s: content: %w", note.ID, err)
+	}
+	if len(note.Tags) == 1 && strings.HasPrefix(note.Tags[0], encryptedPrefix) {
+		tags, err := k.open(note.Tags[0], note.ID, "tags")
+		if err != nil {
+			return Note{}, fmt.Errorf("note %s: tags: %w", note.ID, err)
+		}
+		note.Tags = nil
+		if err := json.Unmarshal([]byte(tags), &note.Tags); err != nil {
+			return Note{}, fmt.Errorf("note %s: tags: %w", note.ID, err)
+		}
+	}
+	return note, nil
+}
+
+// decryptBackup reads the backup at path and writes it to stdout with every sealed field
+// opened, as a plain export that /import takes.
+func decryptBackup(path, passphrase string) error {
+	// the file store takes a missing file for an empty one
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	list, err := NewEncryptedStore(&fileStore{path: path}, passphrase, false).snapshot()
+	if err != nil {
+		return err
+	}
+	return streamNotes(os.Stdout, list)
+}
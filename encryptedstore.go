@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"log"
+	"sync"
+)
+
+// EncryptedStore wraps a NoteStore so that every note reaching it has its content, tags
+// and, if titles is set, title sealed with AES-GCM, under a key derived from a passphrase
+// with scrypt. Callers read and write plain notes, as with any other store.
+//
+// It is meant for the stores that keep notes at rest, like the backup files. The
+// in-memory store holds the notes requests work on and is never written to disk, so it
+// stays plain.
+type EncryptedStore struct {
+	inner  NoteStore
+	titles bool
+
+	mu sync.Mutex
+	// sealer is derived on the first write, with a new salt for each store
+	sealer *noteCipher
+	keys   *backupKeys
+}
+
+func NewEncryptedStore(inner NoteStore, passphrase string, titles bool) *EncryptedStore {
+	return &EncryptedStore{
+		inner:  inner,
+		titles: titles,
+		keys:   &backupKeys{passphrase: passphrase, ciphers: make(map[string]*noteCipher)},
+	}
+}
+
+func (e *EncryptedStore) Ping(ctx context.Context) error {
+	return e.inner.Ping(ctx)
+}
+
+// WithTx runs fn against the wrapped store. A note that fails to seal or open fails the
+// whole transaction, so nothing is written in the clear or based on a note it couldn't
+// read.
+func (e *EncryptedStore) WithTx(fn func(tx Tx) error) error {
+	return e.inner.WithTx(func(inner Tx) error {
+		tx := &encTx{store: e, inner: inner}
+		err := fn(tx)
+		if tx.err != nil {
+			return tx.err
+		}
+		return err
+	})
+}
+
+// Snapshot returns every note opened, or none if one can't be.
+func (e *EncryptedStore) Snapshot() []Note {
+	list, err := e.snapshot()
+	if err != nil {
+		log.Printf("encrypted store: %s", err)
+	}
+	return list
+}
+
+func (e *EncryptedStore) snapshot() ([]Note, error) {
+	var list []Note
+	if inner, ok := e.inner.(snapshotter); ok {
+		var err error
+		if list, err = inner.snapshot(); err != nil {
+			return nil, err
+		}
+	} else {
+		list = e.inner.Snapshot()
+	}
+
+	for i := range list {
+		note, err := e.open(list[i])
+		if err != nil {
+			return nil, err
+		}
+		list[i] = note
+	}
+	return list, nil
+}
+
+func (e *EncryptedStore) seal(note Note) (Note, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.sealer == nil {
+		if e.keys.passphrase == "" {
+			return Note{}, errors.New("no passphrase to encrypt notes with")
+		}
+		c, err := newBackupCipher(e.keys.passphrase)
+		if err != nil {
+			return Note{}, err
+		}
+		e.sealer = c
+		// what this store seals, it opens without deriving the key again
+		e.keys.ciphers[base64.RawStdEncoding.EncodeToString(c.salt)] = c
+	}
+	return e.sealer.encryptNote(note, e.titles)
+}
+
+func (e *EncryptedStore) open(note Note) (Note, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.keys.openNote(note)
+}
+
+// encTx seals what is put through it and opens what is read. The first error is kept
+// for WithTx, since Tx methods can't return one.
+type encTx struct {
+	store *EncryptedStore
+	inner Tx
+	err   error
+}
+
+func (tx *encTx) Get(id string) (Note, bool) {
+	note, ok := tx.inner.Get(id)
+	if !ok {
+		return Note{}, false
+	}
+	note, err := tx.store.open(note)
+	if err != nil {
+		tx.fail(err)
+		return Note{}, false
+	}
+	return note, true
+}
+
+func (tx *encTx) Put(note Note) {
+	sealed, err := tx.store.seal(note)
+	if err != nil {
+		tx.fail(err)
+		return
+	}
+	tx.inner.Put(sealed)
+}
+
+func (tx *encTx) Delete(id string) {
+	tx.inner.Delete(id)
+}
+
+func (tx *encTx) Count() int {
+	return tx.inner.Count()
+}
+
+func (tx *encTx) fail(err error) {
+	if tx.err == nil {
+		tx.err = err
+	}
+}
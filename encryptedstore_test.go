@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncryptedStoreRoundTrip(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	want := []Note{
+		{ID: "1", Title: "Groceries", Content: "milk and secret eggs", Tags: []string{"errands", "private"}, Created: created},
+		{ID: "2", Title: "Untagged", Content: "nothing to tag", Created: created},
+	}
+
+	tests := []struct {
+		name   string
+		titles bool
+		// plain is what must not show anywhere in the file
+		plain []string
+	}{
+		{"content and tags", false, []string{"secret eggs", "nothing to tag", "errands", "private"}},
+		{"titles too", true, []string{"secret eggs", "errands", "Groceries", "Untagged"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "notes.json")
+			enc := NewEncryptedStore(&fileStore{path: path}, "correct horse", tt.titles)
+			err := enc.WithTx(func(tx Tx) error {
+				for _, note := range want {
+					tx.Put(note)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("WithTx: %v", err)
+			}
+
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, plain := range tt.plain {
+				if strings.Contains(string(raw), plain) {
+					t.Errorf("file contains %q in the clear", plain)
+				}
+			}
+
+			// a new store has to derive the key from the passphrase again
+			got, err := NewEncryptedStore(&fileStore{path: path}, "correct horse", false).snapshot()
+			if err != nil {
+				t.Fatalf("snapshot: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("snapshot = %+v, want %+v", got, want)
+			}
+
+			err = enc.WithTx(func(tx Tx) error {
+				note, ok := tx.Get("1")
+				if !ok || note.Content != want[0].Content {
+					t.Errorf("Get(1) = %+v, %v, want the plain note", note, ok)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("WithTx: %v", err)
+			}
+		})
+	}
+}
+
+func TestEncryptedStoreWrongPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.json")
+	err := NewEncryptedStore(&fileStore{path: path}, "correct horse", true).WithTx(func(tx Tx) error {
+		tx.Put(Note{ID: "1", Title: "Title", Content: "content", Tags: []string{"tag"}})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		passphrase string
+	}{
+		{"wrong passphrase", "battery staple"},
+		{"no passphrase", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrong := NewEncryptedStore(&fileStore{path: path}, tt.passphrase, true)
+			if _, err := wrong.snapshot(); err == nil {
+				t.Error("snapshot succeeded")
+			}
+
+			err := wrong.WithTx(func(tx Tx) error {
+				if note, ok := tx.Get("1"); ok {
+					t.Errorf("Get(1) = %+v, want nothing", note)
+				}
+				return nil
+			})
+			if err == nil {
+				t.Error("WithTx succeeded after a Get that couldn't open the note")
+			}
+		})
+	}
+}
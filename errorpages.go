@@ -0,0 +1,42 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+)
+
+// WithNotFoundTemplate renders 404s with the named page instead of error.html. The page
+// is parsed with base.html like the built-in ones and gets an ErrorPage as its data.
+func WithNotFoundTemplate(name string) ServerOption {
+	return func(s *ApiServer) {
+		s.notFoundTemplate = name
+	}
+}
+
+// WithErrorTemplate renders 500s with the named page instead of error.html.
+func WithErrorTemplate(name string) ServerOption {
+	return func(s *ApiServer) {
+		s.errorTemplate = name
+	}
+}
+
+// loadErrorTemplates parses any custom error pages that aren't built in, so a missing
+// or broken template stops the server at startup rather than on the first error.
+func (s *ApiServer) loadErrorTemplates() {
+	for _, name := range []string{s.notFoundTemplate, s.errorTemplate} {
+		if _, ok := templates[name]; ok {
+			continue
+		}
+		tmpl, err := template.ParseFiles("base.html", name)
+		if err != nil {
+			log.Fatalf("error template %q: %s", name, err)
+		}
+		templates[name] = tmpl
+	}
+}
+
+// notFoundPage writes a 404 with the configured not-found template.
+func (s *ApiServer) notFoundPage(w http.ResponseWriter, message string) error {
+	return WriteHTML(w, http.StatusNotFound, templates, s.notFoundTemplate, s.errorPage(message))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// noteETag returns a strong ETag for the current state of a note. Any change to a stored
+// field changes the tag.
+func noteETag(note Note) string {
+	body, _ := json.Marshal(note)
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// lastModified is when the note last changed, for Last-Modified and
+// If-Unmodified-Since. Notes stored before Updated existed fall back to Created.
+func lastModified(note Note) time.Time {
+	if note.Updated.IsZero() {
+		return note.Created
+	}
+	return note.Updated
+}
+
+// ifUnmodifiedSince reports whether the request's If-Unmodified-Since precondition holds
+// for a resource last modified at modified. A request without one, or with a date that
+// doesn't parse, always passes, as RFC 9110 asks. HTTP dates only have whole seconds, so
+// modified is compared truncated to the second.
+func ifUnmodifiedSince(r *http.Request, modified time.Time) bool {
+	since, err := http.ParseTime(r.Header.Get("If-Unmodified-Since"))
+	if err != nil {
+		return true
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// ifNoneMatch reports whether the request's If-None-Match header matches etag, which
+// means the client's copy is current and can be answered with a 304. Comparison is weak,
+// as RFC 9110 asks, so a W/ prefix is ignored.
+func ifNoneMatch(r *http.Request, etag string) bool {
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatch reports whether the request's If-Match precondition holds for etag. A request
+// without If-Match always passes. Comparison is strong, so weak tags never match.
+func ifMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
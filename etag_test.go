@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIfMatch(t *testing.T) {
+	const etag = `"abc"`
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{"no header", "", true},
+		{"matching", `"abc"`, true},
+		{"mismatching", `"xyz"`, false},
+		{"one of a list", `"xyz", "abc"`, true},
+		{"none of a list", `"xyz", "uvw"`, false},
+		{"any", "*", true},
+		{"weak never matches", `W/"abc"`, false},
+		{"unquoted", "abc", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("PUT", "/notes/1", nil)
+			if tt.header != "" {
+				r.Header.Set("If-Match", tt.header)
+			}
+			if got := ifMatch(r, etag); got != tt.want {
+				t.Errorf("ifMatch with %q = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateNoteIfMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		ifMatch func(current string) string
+		want    int
+	}{
+		{"unconditional", func(string) string { return "" }, http.StatusFound},
+		{"current etag", func(current string) string { return current }, http.StatusFound},
+		{"stale etag", func(string) string { return `"stale"` }, http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t)
+			note := storeTestNote(Note{ID: "1", Title: "Old", Content: "old"})
+
+			headers := []string{"Content-Type", "application/x-www-form-urlencoded"}
+			if v := tt.ifMatch(noteETag(note)); v != "" {
+				headers = append(headers, "If-Match", v)
+			}
+			w := serve(h, "PUT", "/notes/1", "title=New&content=new", headers...)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+
+			wantTitle := "New"
+			if tt.want == http.StatusPreconditionFailed {
+				wantTitle = "Old"
+			} else if got := w.Header().Get("ETag"); got != noteETag(notes["1"]) {
+				t.Errorf("ETag = %q, want the updated note's %q", got, noteETag(notes["1"]))
+			}
+			if got := notes["1"].Title; got != wantTitle {
+				t.Errorf("title = %q, want %q", got, wantTitle)
+			}
+		})
+	}
+}
+
+func TestLastModified(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	updated := created.Add(time.Hour)
+	tests := []struct {
+		name string
+		note Note
+		want time.Time
+	}{
+		{"updated", Note{Created: created, Updated: updated}, updated},
+		{"never updated", Note{Created: created}, created},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lastModified(tt.note); !got.Equal(tt.want) {
+				t.Errorf("lastModified = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteNoteIfUnmodifiedSince(t *testing.T) {
+	date := func(t time.Time) string { return t.UTC().Format(http.TimeFormat) }
+	tests := []struct {
+		name  string
+		since func(updated time.Time) string
+		want  int
+	}{
+		{"unconditional", func(time.Time) string { return "" }, http.StatusFound},
+		{"as last seen", func(updated time.Time) string { return date(updated) }, http.StatusFound},
+		{"seen later", func(updated time.Time) string { return date(updated.Add(time.Hour)) }, http.StatusFound},
+		{"changed since", func(updated time.Time) string { return date(updated.Add(-time.Second)) }, http.StatusPreconditionFailed},
+		{"changed long since", func(updated time.Time) string { return date(updated.Add(-24 * time.Hour)) }, http.StatusPreconditionFailed},
+		{"not a date", func(time.Time) string { return "yesterday" }, http.StatusFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t)
+			note := storeTestNote(Note{ID: "1", Title: "Note", Content: "x", Created: time.Now().Add(-48 * time.Hour)})
+
+			var headers []string
+			if v := tt.since(note.Updated); v != "" {
+				headers = []string{"If-Unmodified-Since", v}
+			}
+			w := serve(h, "DELETE", "/notes/1", "", headers...)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if _, kept := notes["1"]; kept != (tt.want == http.StatusPreconditionFailed) {
+				t.Errorf("note kept = %v after a %d", kept, w.Code)
+			}
+		})
+	}
+}
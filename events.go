@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// eventBuffer is how many events a subscriber may fall behind before it misses some.
+const eventBuffer = 16
+
+// eventKeepAlive is how often an idle event stream gets a comment, so proxies don't
+// close it.
+const eventKeepAlive = 30 * time.Second
+
+// eventSnippetLength is how many characters of content a previewing event carries.
+const eventSnippetLength = 200
+
+// NoteEvent tells /events subscribers that a note changed.
+type NoteEvent struct {
+	// Type is "created", "updated" or "deleted"
+	Type string `json:"type"`
+	ID   string `json:"id"`
+
+	// Title and Snippet preview the note as it now is, so a client can update in place
+	// without fetching it. They are only sent with -event-previews, and never for deletes.
+	Title   string `json:"title,omitempty"`
+	Snippet string `json:"snippet,omitempty"`
+}
+
+// noteChanged returns the event for note having been created or updated. The preview is
+// left out unless a subscriber wants previews, so writes don't pay for it otherwise.
+func noteChanged(eventType string, note Note) NoteEvent {
+	event := NoteEvent{Type: eventType, ID: note.ID}
+	if events.previewing.Load() > 0 {
+		event.Title = note.Title
+		event.Snippet = snippet(note.Content, eventSnippetLength)
+	}
+	return event
+}
+
+// broker fans note events out to the /events subscribers.
+type broker struct {
+	mu sync.Mutex
+	// subscribers maps each subscriber to whether it is sent previews
+	subscribers map[chan NoteEvent]bool
+
+	// active is how many subscribers there are, counted apart from the map so the cap can
+	// be checked without taking the lock
+	active atomic.Int64
+	// previewing is how many of them are sent previews
+	previewing atomic.Int64
+}
+
+var events = &broker{subscribers: make(map[chan NoteEvent]bool)}
+
+// subscribe adds a subscriber unless there already are max of them, zero or less for no
+// limit. It reports false when the broker is full. A subscriber that is sent previews
+// makes every event carry one.
+func (b *broker) subscribe(max int, previews bool) (chan NoteEvent, bool) {
+	for {
+		n := b.active.Load()
+		if max > 0 && n >= int64(max) {
+			return nil, false
+		}
+		if b.active.CompareAndSwap(n, n+1) {
+			break
+		}
+	}
+
+	if previews {
+		b.previewing.Add(1)
+	}
+
+	ch := make(chan NoteEvent, eventBuffer)
+	b.mu.Lock()
+	b.subscribers[ch] = previews
+	b.mu.Unlock()
+	return ch, true
+}
+
+func (b *broker) unsubscribe(ch chan NoteEvent) {
+	b.mu.Lock()
+	previews := b.subscribers[ch]
+	delete(b.subscribers, ch)
+	b.mu.Unlock()
+	if previews {
+		b.previewing.Add(-1)
+	}
+	b.active.Add(-1)
+}
+
+// publish sends an event to every subscriber without blocking. It is called with mu
+// held, so a subscriber that has fallen behind misses the event instead of stalling
+// every write.
+func (b *broker) publish(event NoteEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// WithMaxEventSubscribers caps how many clients may listen on /events at once. Past it,
+// new ones get a 503. Zero or less means no cap.
+func WithMaxEventSubscribers(n int) ServerOption {
+	return func(s *ApiServer) {
+		s.maxEventSubscribers = n
+	}
+}
+
+// WithEventPreviews makes /events carry each changed note's title and a snippet of its
+// content, not just its id, so clients can update without refetching. Off by default,
+// which keeps the stream to the lightweight signal.
+func WithEventPreviews(previews bool) ServerOption {
+	return func(s *ApiServer) {
+		s.eventPreviews = previews
+	}
+}
+
+// events handler
+// --------------
+// eventsHandler streams note changes as server-sent events until the client goes away or
+// the server stops.
+func (s *ApiServer) eventsHandler(w http.ResponseWriter, r *http.Request) error {
+	ch, ok := events.subscribe(s.maxEventSubscribers, s.eventPreviews)
+	if !ok {
+		s.serviceUnavailable(w, r)
+		return nil
+	}
+	defer events.unsubscribe(ch)
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		// the stream can't work without flushing, and the status line is already written
+		log.Println("events:", err)
+		return nil
+	}
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-s.quit:
+			return nil
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case event := <-ch:
+			if !s.eventPreviews {
+				event.Title, event.Snippet = "", ""
+			}
+			data, _ := json.Marshal(event)
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
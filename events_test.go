@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBrokerSubscriberCap(t *testing.T) {
+	tests := []struct {
+		name string
+		max  int
+		open int
+		want bool // whether one more may subscribe
+	}{
+		{"no cap", 0, 50, true},
+		{"under the cap", 3, 2, true},
+		{"at the cap", 3, 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &broker{subscribers: make(map[chan NoteEvent]bool)}
+			for i := 0; i < tt.open; i++ {
+				if _, ok := b.subscribe(tt.max, false); !ok {
+					t.Fatalf("subscriber %d was rejected", i+1)
+				}
+			}
+			ch, ok := b.subscribe(tt.max, false)
+			if ok != tt.want {
+				t.Fatalf("subscribe = %v, want %v", ok, tt.want)
+			}
+			if ok {
+				b.unsubscribe(ch)
+			}
+			if got := b.active.Load(); got != int64(tt.open) {
+				t.Errorf("active = %d, want %d", got, tt.open)
+			}
+		})
+	}
+}
+
+// openEvents connects to /events and returns the response status. The stream stays open
+// until the test ends.
+func openEvents(t *testing.T, url string) (int, context.CancelFunc) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, "GET", url+"/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+	}
+	return resp.StatusCode, cancel
+}
+
+func TestEventsSubscriberCap(t *testing.T) {
+	const max = 3
+	_, h := newTestServer(t, WithMaxEventSubscribers(max))
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	var first context.CancelFunc
+	for i := 0; i < max; i++ {
+		code, cancel := openEvents(t, srv.URL)
+		if code != http.StatusOK {
+			t.Fatalf("connection %d: status = %d, want %d", i+1, code, http.StatusOK)
+		}
+		if first == nil {
+			first = cancel
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if code, _ := openEvents(t, srv.URL); code != http.StatusServiceUnavailable {
+			t.Errorf("connection past the cap: status = %d, want %d", code, http.StatusServiceUnavailable)
+		}
+	}
+
+	// a closed stream frees its place
+	first()
+	deadline := time.Now().Add(5 * time.Second)
+	for events.active.Load() >= max {
+		if time.Now().After(deadline) {
+			t.Fatal("the closed stream is still subscribed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if code, _ := openEvents(t, srv.URL); code != http.StatusOK {
+		t.Errorf("connection after one closed: status = %d, want %d", code, http.StatusOK)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// WithSweepInterval sets how often the background sweeper removes expired notes.
+func WithSweepInterval(d time.Duration) ServerOption {
+	return func(s *ApiServer) {
+		s.sweepInterval = d
+	}
+}
+
+// parseTTL turns a ttl form value like "1h" into an absolute expiry time relative to from.
+func parseTTL(from time.Time, ttl string) (time.Time, error) {
+	d, err := time.ParseDuration(ttl)
+	if err != nil || d <= 0 {
+		return time.Time{}, fmt.Errorf("invalid ttl: %q", ttl)
+	}
+	return from.Add(d), nil
+}
+
+func (n Note) expired(now time.Time) bool {
+	return n.ExpiresAt != nil && !now.Before(*n.ExpiresAt)
+}
+
+// sweepExpiredNotes periodically deletes expired notes past the purge age, stale drafts
+// and finished create cooldowns until the server is stopped.
+func (s *ApiServer) sweepExpiredNotes() {
+	ticker := time.NewTicker(s.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		case now := <-ticker.C:
+			mu.Lock()
+			for id, note := range notes {
+				if purgeable(note, now, s.purgeAge) {
+					removeNote(id)
+				}
+			}
+			mu.Unlock()
+
+			s.sweepDrafts(now)
+			s.sweepCreates(now)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// exportHandler downloads every note as a JSON array, oldest first. It works from a
+// snapshot so the lock is only held while copying, not while encoding, and streams the
+// array one note at a time so large stores never sit in memory as a single encoded body.
+func (s *ApiServer) exportHandler(w http.ResponseWriter, r *http.Request) error {
+	list := exportedNotes(time.Now())
+
+	// streamed, so it can't go through WriteBytes
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", `attachment; filename="notes.json"`)
+	w.WriteHeader(http.StatusOK)
+
+	// the status is already on the wire, so a failure from here on can only be logged
+	if err := streamNotes(w, list); err != nil {
+		log.Printf("export: %s", err)
+	}
+	return nil
+}
+
+// exportedNotes returns the notes that haven't expired by now, oldest first, copied from
+// the store so nothing needs the lock while they are written out.
+func exportedNotes(now time.Time) []Note {
+	list := make([]Note, 0)
+	for _, note := range store.Snapshot() {
+		if !note.expired(now) {
+			list = append(list, note)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Created.Before(list[j].Created)
+	})
+	return list
+}
+
+// streamNotes writes notes to w as a JSON array, encoding one element at a time.
+func streamNotes(w io.Writer, notes []Note) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	if _, err := bw.WriteString("["); err != nil {
+		return err
+	}
+	for i, note := range notes {
+		if i > 0 {
+			if _, err := bw.WriteString(","); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(note); err != nil {
+			return err
+		}
+	}
+	if _, err := bw.WriteString("]\n"); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// markdownEscaper backslash escapes the characters that would make a title or tag render
+// as something other than text: emphasis, links, code, html, headings and tables.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+	"<", `\<`, ">", `\>`, "#", `\#`, "|", `\|`, "~", `\~`,
+)
+
+// markdownExportHandler downloads every note as one Markdown document, oldest first, for
+// moving notes into other Markdown tools. Each note is a ## heading with its metadata as a
+// list and its content in a fenced block, so nothing in the content can break the
+// document's structure.
+func (s *ApiServer) markdownExportHandler(w http.ResponseWriter, r *http.Request) error {
+	now := time.Now()
+	list := exportedNotes(now)
+
+	// streamed, like the JSON export
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", `attachment; filename="notes.md"`)
+	w.WriteHeader(http.StatusOK)
+
+	if err := writeMarkdown(w, list, now); err != nil {
+		log.Printf("export: %s", err)
+	}
+	return nil
+}
+
+// writeMarkdown writes notes to w as a Markdown document.
+func writeMarkdown(w io.Writer, notes []Note, now time.Time) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# Notes\n\nExported %s, %d notes.\n", now.UTC().Format(time.RFC3339), len(notes))
+
+	for _, note := range notes {
+		title := strings.TrimSpace(whitespacePattern.ReplaceAllString(note.Title, " "))
+		fmt.Fprintf(bw, "\n## %s\n\n", markdownEscaper.Replace(title))
+		fmt.Fprintf(bw, "- ID: %s\n", note.ID)
+		fmt.Fprintf(bw, "- Created: %s\n", note.Created.UTC().Format(time.RFC3339))
+		if note.ExpiresAt != nil {
+			fmt.Fprintf(bw, "- Expires: %s\n", note.ExpiresAt.UTC().Format(time.RFC3339))
+		}
+		if len(note.Tags) > 0 {
+			tags := make([]string, len(note.Tags))
+			for i, tag := range note.Tags {
+				tags[i] = markdownEscaper.Replace(tag)
+			}
+			fmt.Fprintf(bw, "- Tags: %s\n", strings.Join(tags, ", "))
+		}
+
+		fence := markdownFence(note.Content)
+		fmt.Fprintf(bw, "\n%smarkdown\n%s\n%s\n", fence, strings.TrimRight(note.Content, "\n"), fence)
+	}
+	return bw.Flush()
+}
+
+// markdownFence returns a code fence longer than any run of backticks in content, so
+// the content can't close it early.
+func markdownFence(content string) string {
+	longest, run := 0, 0
+	for _, r := range content {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStreamNotes(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		notes []Note
+	}{
+		{"none", []Note{}},
+		{"one", []Note{{ID: "1", Title: "One", Content: "a \"quoted\"\nline", Created: created}}},
+		{"several", []Note{
+			{ID: "1", Title: "One", Created: created, Tags: []string{"a"}},
+			{ID: "2", Title: "Two", Content: "<b>html</b> & more", Created: created},
+			{ID: "3", Title: "Three", Created: created, Locked: true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := streamNotes(&buf, tt.notes); err != nil {
+				t.Fatalf("streamNotes: %v", err)
+			}
+			if !json.Valid(buf.Bytes()) {
+				t.Fatalf("not valid JSON: %s", buf.Bytes())
+			}
+
+			var got []Note
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.notes) {
+				t.Errorf("decoded %+v, want %+v", got, tt.notes)
+			}
+		})
+	}
+}
+
+func TestExportHandler(t *testing.T) {
+	_, h := newTestServer(t)
+	now := time.Now()
+	expired := now.Add(-time.Minute)
+	storeTestNote(Note{ID: "2", Title: "Newer", Created: now.Add(-time.Hour)})
+	storeTestNote(Note{ID: "1", Title: "Older", Created: now.Add(-2 * time.Hour)})
+	storeTestNote(Note{ID: "3", Title: "Expired", Created: now.Add(-3 * time.Hour), ExpiresAt: &expired})
+
+	w := serve(h, "GET", "/export", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="notes.json"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+
+	var list []Note
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("invalid JSON: %v: %s", err, w.Body)
+	}
+	var ids []string
+	for _, note := range list {
+		ids = append(ids, note.ID)
+	}
+	if want := []string{"1", "2"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("exported ids %v, want %v, oldest first without the expired one", ids, want)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// parseFields splits the ?fields= list of a request. An empty list means all fields.
+func parseFields(list string) []string {
+	var fields []string
+	for _, field := range strings.Split(list, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// selectFields returns note as a map holding only the requested fields, matched against
+// the note's JSON keys without regard to case. Unknown field names are ignored. With no
+// fields it returns the note unchanged.
+func selectFields(note Note, fields []string) (any, error) {
+	if len(fields) == 0 {
+		return note, nil
+	}
+
+	body, err := json.Marshal(note)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]any
+	if err := json.Unmarshal(body, &all); err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]any, len(fields))
+	for key, value := range all {
+		for _, field := range fields {
+			if strings.EqualFold(key, field) {
+				selected[key] = value
+				break
+			}
+		}
+	}
+	return selected, nil
+}
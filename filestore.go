@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fileStore keeps notes in a JSON file, in the format /export writes. Every transaction
+// reads the whole file and writes it back, so it suits files written now and then, like
+// backups, rather than the notes requests work on. A file that doesn't exist yet holds
+// no notes.
+type fileStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (f *fileStore) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err := os.Stat(filepath.Dir(f.path))
+	return err
+}
+
+// WithTx runs fn against the notes in the file and writes them back if it returns nil.
+// Replaced notes keep their place in the file and new ones are added at the end.
+func (f *fileStore) WithTx(fn func(tx Tx) error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list, err := f.load()
+	if err != nil {
+		return err
+	}
+	stored := make(map[string]Note, len(list))
+	for _, note := range list {
+		stored[note.ID] = note
+	}
+
+	tx := &memTx{notes: stored, staged: make(map[string]*Note)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	kept := make([]Note, 0, len(list)+len(tx.order))
+	for _, note := range list {
+		staged, ok := tx.staged[note.ID]
+		switch {
+		case !ok:
+			kept = append(kept, note)
+		case staged != nil:
+			kept = append(kept, *staged)
+		}
+	}
+	for _, id := range tx.order {
+		if _, ok := stored[id]; !ok && tx.staged[id] != nil {
+			kept = append(kept, *tx.staged[id])
+		}
+	}
+	return f.write(kept)
+}
+
+// Snapshot returns the notes in the file, or none if it can't be read.
+func (f *fileStore) Snapshot() []Note {
+	list, err := f.snapshot()
+	if err != nil {
+		log.Printf("file store: %s", err)
+	}
+	return list
+}
+
+func (f *fileStore) snapshot() ([]Note, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.load()
+}
+
+func (f *fileStore) load() ([]Note, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Note
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%s: %w", f.path, err)
+	}
+	return list, nil
+}
+
+// write replaces the file with list. It writes to a temporary file first and renames it
+// into place, so a crash halfway through never leaves a truncated file behind.
+func (f *fileStore) write(list []Note) error {
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), ".tmp-"+filepath.Base(f.path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly once renamed
+
+	if err := streamNotes(tmp, list); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
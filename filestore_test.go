@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileStoreWithTx(t *testing.T) {
+	initial := []Note{{ID: "1", Title: "One"}, {ID: "2", Title: "Two"}, {ID: "3", Title: "Three"}}
+
+	tests := []struct {
+		name    string
+		fn      func(tx Tx) error
+		wantErr bool
+		want    []Note
+	}{
+		{"replaced notes keep their place", func(tx Tx) error {
+			tx.Put(Note{ID: "2", Title: "Two again"})
+			return nil
+		}, false, []Note{{ID: "1", Title: "One"}, {ID: "2", Title: "Two again"}, {ID: "3", Title: "Three"}}},
+		{"new notes go at the end", func(tx Tx) error {
+			tx.Put(Note{ID: "5", Title: "Five"})
+			tx.Put(Note{ID: "4", Title: "Four"})
+			return nil
+		}, false, []Note{{ID: "1", Title: "One"}, {ID: "2", Title: "Two"}, {ID: "3", Title: "Three"}, {ID: "5", Title: "Five"}, {ID: "4", Title: "Four"}}},
+		{"deleted", func(tx Tx) error {
+			tx.Delete("2")
+			return nil
+		}, false, []Note{{ID: "1", Title: "One"}, {ID: "3", Title: "Three"}}},
+		{"added then deleted", func(tx Tx) error {
+			tx.Put(Note{ID: "4", Title: "Four"})
+			tx.Delete("4")
+			return nil
+		}, false, initial},
+		{"rolled back", func(tx Tx) error {
+			tx.Put(Note{ID: "4", Title: "Four"})
+			tx.Delete("1")
+			return errors.New("changed my mind")
+		}, true, initial},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fileStore{path: filepath.Join(t.TempDir(), "notes.json")}
+			if err := f.WithTx(func(tx Tx) error {
+				for _, note := range initial {
+					tx.Put(note)
+				}
+				return nil
+			}); err != nil {
+				t.Fatalf("WithTx: %v", err)
+			}
+
+			if err := f.WithTx(tt.fn); (err != nil) != tt.wantErr {
+				t.Fatalf("WithTx = %v, want error %v", err, tt.wantErr)
+			}
+			got, err := f.snapshot()
+			if err != nil {
+				t.Fatalf("snapshot: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("notes = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileStoreMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.json")
+	f := &fileStore{path: path}
+	if got, err := f.snapshot(); err != nil || len(got) != 0 {
+		t.Fatalf("snapshot = %v, %v, want no notes", got, err)
+	}
+
+	// even a transaction that stores nothing leaves a file behind
+	if err := f.WithTx(func(Tx) error { return nil }); err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("no file written: %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// noteFilter is the subset of notes a list view asks for with ?tag=, ?from= and ?to=.
+// The dates are YYYY-MM-DD days in the server's time zone, and both ends are inclusive.
+type noteFilter struct {
+	tag  string
+	from time.Time // zero for no lower bound
+	to   time.Time // the start of the day after ?to=, zero for no upper bound
+}
+
+// parseNoteFilter reads the list filter parameters from the query.
+func parseNoteFilter(r *http.Request) (noteFilter, error) {
+	q := r.URL.Query()
+	filter := noteFilter{tag: strings.TrimSpace(q.Get("tag"))}
+
+	if v := q.Get("from"); v != "" {
+		day, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return noteFilter{}, fmt.Errorf("invalid from date %q, use YYYY-MM-DD", v)
+		}
+		filter.from = day
+	}
+	if v := q.Get("to"); v != "" {
+		day, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return noteFilter{}, fmt.Errorf("invalid to date %q, use YYYY-MM-DD", v)
+		}
+		filter.to = day.AddDate(0, 0, 1)
+	}
+	return filter, nil
+}
+
+// match reports whether a note is in the filtered subset. Tags match case-insensitively,
+// like cleanTags treats them.
+func (f noteFilter) match(note Note) bool {
+	if !f.from.IsZero() && note.Created.Before(f.from) {
+		return false
+	}
+	if !f.to.IsZero() && !note.Created.Before(f.to) {
+		return false
+	}
+	if f.tag == "" {
+		return true
+	}
+	for _, tag := range note.Tags {
+		if strings.EqualFold(tag, f.tag) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// fetchExcerptLength is how many characters of a fetched page a note keeps.
+const fetchExcerptLength = 500
+
+var (
+	pageTitlePattern       = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	pageDescriptionPattern = regexp.MustCompile(`(?is)<meta\s[^>]*(?:name|property)\s*=\s*["'](?:og:)?description["'][^>]*>`)
+	metaContentPattern     = regexp.MustCompile(`(?is)\scontent\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	pageBodyPattern        = regexp.MustCompile(`(?is)<body[^>]*>(.*)`)
+	pageNoisePattern       = regexp.MustCompile(`(?is)<(script|style|noscript|template)[^>]*>.*?</(?:script|style|noscript|template)>`)
+)
+
+var errPrivateAddress = errors.New("refusing to fetch from a private or local address")
+
+// WithNoteFetch turns on POST /notes/from-url, which clips a web page into a note. Each
+// fetch may take up to timeout and read up to maxBytes of the page. It is off by default:
+// it makes the server send requests wherever its users ask, so it only ever connects to
+// public addresses, and never follows a redirect off http or https.
+func WithNoteFetch(enabled bool, timeout time.Duration, maxBytes int64) ServerOption {
+	return func(s *ApiServer) {
+		if !enabled {
+			s.fetchClient = nil
+			return
+		}
+		s.fetchMaxBytes = maxBytes
+		s.fetchClient = newFetchClient(timeout)
+	}
+}
+
+// newFetchClient returns a client that only connects to public unicast addresses. The
+// check runs on the address actually dialled, after DNS, so a name can't resolve its way
+// around it, and it covers every redirect too.
+func newFetchClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+				return errPrivateAddress
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		// no Proxy, a proxy from the environment would be dialled instead of the page
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirected to an unsupported scheme: %s", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// fetchPage downloads an HTML page and returns its title and a plain text excerpt: its
+// description if it has one, else the start of its text.
+func (s *ApiServer) fetchPage(target *url.URL) (string, string, error) {
+	resp, err := s.fetchClient.Get(target.String())
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", "", fmt.Errorf("the page answered %s", resp.Status)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/html" {
+		return "", "", fmt.Errorf("the page is %q, not HTML", mediaType)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, s.fetchMaxBytes))
+	if err != nil {
+		return "", "", err
+	}
+	page := sanitizeContent(string(body))
+
+	var title string
+	if match := pageTitlePattern.FindStringSubmatch(page); match != nil {
+		title = snippet(html.UnescapeString(match[1]), 200)
+	}
+
+	var excerpt string
+	if meta := pageDescriptionPattern.FindString(page); meta != "" {
+		if match := metaContentPattern.FindStringSubmatch(meta); match != nil {
+			excerpt = snippet(html.UnescapeString(match[1]+match[2]), fetchExcerptLength)
+		}
+	}
+	if excerpt == "" {
+		text := page
+		if match := pageBodyPattern.FindStringSubmatch(page); match != nil {
+			text = match[1]
+		}
+		text = pageNoisePattern.ReplaceAllString(text, " ")
+		text = tagPattern.ReplaceAllString(text, " ")
+		excerpt = snippet(html.UnescapeString(text), fetchExcerptLength)
+	}
+	return title, excerpt, nil
+}
+
+// from-url handler
+// ----------------
+// noteFromURLHandler clips the page at the url form value into a new note, titled with
+// the page's title, holding an excerpt of it and a link back to it.
+func (s *ApiServer) noteFromURLHandler(w http.ResponseWriter, r *http.Request) error {
+	if s.fetchClient == nil {
+		return WriteJSON(r, w, http.StatusNotFound, ApiError{Error: "creating notes from a url is turned off"})
+	}
+	session, wait, err := s.cooldownLeft(w, r)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return s.tooSoon(w, r, wait)
+	}
+
+	if err := s.parseForm(r); err != nil {
+		return WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: err.Error()})
+	}
+	target, err := url.Parse(strings.TrimSpace(r.FormValue("url")))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: "url must be an absolute http or https url"})
+	}
+
+	title, excerpt, err := s.fetchPage(target)
+	if err != nil {
+		return WriteJSON(r, w, http.StatusBadGateway, ApiError{Error: "could not fetch the page: " + err.Error()})
+	}
+	if title == "" {
+		title = target.Host
+	}
+
+	note := Note{
+		ID:      s.generateID(),
+		Title:   title,
+		Content: strings.TrimSpace(excerpt + "\n\nSource: " + target.String()),
+		Created: time.Now(),
+	}
+	note.Tags = s.withDefaultTags(nil)
+	if err := s.validateNote(note); err != nil {
+		return WriteJSON(r, w, http.StatusBadRequest, validationBody(err))
+	}
+
+	mu.Lock()
+	if s.atNoteLimit(len(notes)) {
+		mu.Unlock()
+		return WriteJSON(r, w, http.StatusInsufficientStorage, ApiError{Error: errNoteLimit(s.maxTotalNotes).Error()})
+	}
+	note = putNote(note)
+	mu.Unlock()
+
+	recordCreate(session)
+	s.notifyCreated(r, note)
+
+	w.Header().Set("X-Note-ID", note.ID)
+	return WriteJSON(r, w, http.StatusCreated, note)
+}
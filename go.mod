@@ -2,4 +2,16 @@ module github.com/cgradwohl/go-html-server
 
 go 1.21.1
 
-require github.com/a-h/templ v0.2.513 // indirect
+require (
+	github.com/a-h/templ v0.2.513
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/trace v1.24.0
+	golang.org/x/crypto v0.19.0
+	golang.org/x/text v0.14.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	go.opentelemetry.io/otel/metric v1.24.0 // indirect
+)
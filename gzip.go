@@ -0,0 +1,176 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// WithGzip sets the gzip level responses are compressed with, from gzip.HuffmanOnly to
+// gzip.BestCompression, trading CPU for bandwidth. gzip.NoCompression turns compression
+// off. Bodies shorter than minSize bytes are sent as they are, since they gain little.
+func WithGzip(level, minSize int) ServerOption {
+	return func(s *ApiServer) {
+		s.gzipLevel = level
+		s.gzipMinSize = minSize
+	}
+}
+
+// acceptsGzip reports whether the client takes gzip encoded responses, going by its
+// Accept-Encoding header. An explicit q=0 refuses it.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// withGzip compresses response bodies for clients that accept gzip. Writers come from a
+// pool per server, since each holds a sizeable compression state.
+func (s *ApiServer) withGzip(next http.Handler) http.Handler {
+	if s.gzipLevel == gzip.NoCompression {
+		return next
+	}
+
+	pool := sync.Pool{New: func() any {
+		// the level is checked at startup, so this can't fail
+		gz, _ := gzip.NewWriterLevel(io.Discard, s.gzipLevel)
+		return gz
+	}}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the body may be compressed or not depending on this header, so caches must know
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == "HEAD" || !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipWriter{ResponseWriter: w, pool: &pool, minSize: s.gzipMinSize, status: http.StatusOK}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// gzipWriter holds back the start of a body until it knows whether the body reaches the
+// minimum size, then either compresses everything or writes it through untouched.
+type gzipWriter struct {
+	http.ResponseWriter
+	pool    *sync.Pool
+	minSize int
+
+	status      int
+	wroteHeader bool
+	buf         []byte
+	decided     bool
+	gz          *gzip.Writer // nil when the body goes out uncompressed
+}
+
+func (gw *gzipWriter) WriteHeader(code int) {
+	if gw.wroteHeader {
+		return
+	}
+	gw.status, gw.wroteHeader = code, true
+	// informational and bodiless responses have nothing to decide about
+	if code < 200 || code == http.StatusNoContent || code == http.StatusNotModified {
+		gw.decide(false)
+	}
+}
+
+func (gw *gzipWriter) Write(b []byte) (int, error) {
+	if !gw.decided {
+		gw.buf = append(gw.buf, b...)
+		if len(gw.buf) < gw.minSize {
+			return len(b), nil
+		}
+		if err := gw.start(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if gw.gz != nil {
+		return gw.gz.Write(b)
+	}
+	return gw.ResponseWriter.Write(b)
+}
+
+// decide sends the headers, compressed or not, without writing any of the body yet.
+func (gw *gzipWriter) decide(compress bool) {
+	gw.decided = true
+	h := gw.Header()
+	// a handler that encoded its body itself knows best
+	if compress && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		gw.gz = gw.pool.Get().(*gzip.Writer)
+		gw.gz.Reset(gw.ResponseWriter)
+	}
+	gw.ResponseWriter.WriteHeader(gw.status)
+}
+
+// start decides and writes out what was held back.
+func (gw *gzipWriter) start(compress bool) error {
+	gw.decide(compress)
+	buf := gw.buf
+	gw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if gw.gz != nil {
+		_, err = gw.gz.Write(buf)
+	} else {
+		_, err = gw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// FlushError sends what has been written so far, for http.ResponseController. A body
+// that is flushed before it reaches the minimum size, like an event stream, is sent
+// uncompressed from then on.
+func (gw *gzipWriter) FlushError() error {
+	if !gw.decided {
+		if err := gw.start(false); err != nil {
+			return err
+		}
+	}
+	if gw.gz != nil {
+		if err := gw.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(gw.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (gw *gzipWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
+
+// close finishes the response: a body still held back is too small to compress, and a
+// compressed one needs its gzip trailer.
+func (gw *gzipWriter) close() {
+	if !gw.decided {
+		// a handler that wrote nothing at all still answered with its status
+		gw.start(false)
+		return
+	}
+	if gw.gz != nil {
+		gw.gz.Close()
+		gw.pool.Put(gw.gz)
+		gw.gz = nil
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip;q=0.5", true},
+		{"GZIP", true},
+		{"*", true},
+		{"br", false},
+		{"gzip;q=0", false},
+		{"gzip; q=0.0", false},
+		{"*;q=0", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "/", nil)
+			r.Header.Set("Accept-Encoding", tt.header)
+			if got := acceptsGzip(r); got != tt.want {
+				t.Errorf("acceptsGzip(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGzip(t *testing.T) {
+	tests := []struct {
+		name     string
+		level    int
+		minSize  int
+		method   string
+		target   string
+		encoding string
+		want     bool // whether the body is compressed
+	}{
+		{"large response", gzip.DefaultCompression, 1024, "GET", "/export", "gzip", true},
+		{"fastest", gzip.BestSpeed, 1024, "GET", "/export", "gzip", true},
+		{"smallest", gzip.BestCompression, 1024, "GET", "/export", "gzip", true},
+		{"huffman only", gzip.HuffmanOnly, 1024, "GET", "/export", "gzip", true},
+		{"below the minimum size", gzip.DefaultCompression, 1024, "GET", "/healthz", "gzip", false},
+		{"not accepted", gzip.DefaultCompression, 1024, "GET", "/export", "", false},
+		{"refused", gzip.DefaultCompression, 1024, "GET", "/export", "gzip;q=0", false},
+		{"HEAD", gzip.DefaultCompression, 1024, "HEAD", "/export", "gzip", false},
+		{"off", gzip.NoCompression, 1024, "GET", "/export", "gzip", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t, WithGzip(tt.level, tt.minSize))
+			storeTestNote(Note{ID: "1", Title: "Big", Content: strings.Repeat("all work and no play ", 1000), Created: time.Now()})
+
+			plain := serve(h, tt.method, tt.target, "")
+			w := serve(h, tt.method, tt.target, "", "Accept-Encoding", tt.encoding)
+			if w.Code != plain.Code {
+				t.Fatalf("status = %d, want %d", w.Code, plain.Code)
+			}
+
+			compressed := w.Header().Get("Content-Encoding") == "gzip"
+			if compressed != tt.want {
+				t.Fatalf("compressed = %v, want %v", compressed, tt.want)
+			}
+			if tt.level != gzip.NoCompression && !strings.Contains(w.Header().Get("Vary"), "Accept-Encoding") {
+				t.Errorf("Vary = %q, want Accept-Encoding", w.Header().Get("Vary"))
+			}
+			if !compressed {
+				if !bytes.Equal(w.Body.Bytes(), plain.Body.Bytes()) {
+					t.Error("uncompressed body differs")
+				}
+				return
+			}
+
+			if w.Body.Len() >= plain.Body.Len() {
+				t.Errorf("compressed to %d bytes from %d", w.Body.Len(), plain.Body.Len())
+			}
+			gz, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := io.ReadAll(gz)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(body, plain.Body.Bytes()) {
+				t.Error("decompressed body differs from the uncompressed one")
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// pingTimeout bounds how long a health check waits on the store.
+const pingTimeout = 2 * time.Second
+
+type HealthStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// healthzHandler reports whether the server is alive and its store answers.
+func (s *ApiServer) healthzHandler(w http.ResponseWriter, r *http.Request) error {
+	return s.writeHealth(w, r, false)
+}
+
+// readyzHandler reports whether the server should be sent traffic: its store answers and
+// it isn't draining or shutting down.
+func (s *ApiServer) readyzHandler(w http.ResponseWriter, r *http.Request) error {
+	return s.writeHealth(w, r, true)
+}
+
+func (s *ApiServer) writeHealth(w http.ResponseWriter, r *http.Request, ready bool) error {
+	if ready {
+		select {
+		case <-s.quit:
+			return WriteJSON(r, w, http.StatusServiceUnavailable, HealthStatus{Status: "unavailable", Error: "shutting down"})
+		default:
+		}
+		if s.drainStatus().Draining {
+			return WriteJSON(r, w, http.StatusServiceUnavailable, HealthStatus{Status: "unavailable", Error: "draining"})
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), pingTimeout)
+	defer cancel()
+
+	if err := store.Ping(ctx); err != nil {
+		return WriteJSON(r, w, http.StatusServiceUnavailable, HealthStatus{Status: "unavailable", Error: "store: " + err.Error()})
+	}
+	return WriteJSON(r, w, http.StatusOK, HealthStatus{Status: "ok"})
+}
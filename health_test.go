@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// pingStore is the in-memory store with a Ping that answers err.
+type pingStore struct {
+	memStore
+	err error
+}
+
+func (p pingStore) Ping(ctx context.Context) error {
+	return p.err
+}
+
+func TestHealth(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		pingErr   error
+		drain     bool
+		want      int
+		wantError string
+	}{
+		{"ready", "/readyz", nil, false, http.StatusOK, ""},
+		{"store down", "/readyz", errors.New("connection refused"), false, http.StatusServiceUnavailable, "store: connection refused"},
+		{"draining", "/readyz", nil, true, http.StatusServiceUnavailable, "draining"},
+		{"alive", "/healthz", nil, false, http.StatusOK, ""},
+		{"alive but the store is down", "/healthz", errors.New("connection refused"), false, http.StatusServiceUnavailable, "store: connection refused"},
+		{"alive while draining", "/healthz", nil, true, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, h := newTestServer(t)
+			store = pingStore{err: tt.pingErr}
+			if tt.drain {
+				s.drain()
+			}
+
+			w := serve(h, "GET", tt.target, "")
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			var status HealthStatus
+			if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+				t.Fatalf("invalid JSON: %v: %s", err, w.Body)
+			}
+			if status.Error != tt.wantError {
+				t.Errorf("error = %q, want %q", status.Error, tt.wantError)
+			}
+		})
+	}
+}
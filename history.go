@@ -0,0 +1,170 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+// types
+// -----
+// DiffOp is one run of text in a diff. Kind is "equal", "insert" or "delete".
+type DiffOp struct {
+	Kind string
+	Text string
+}
+
+type DiffPage struct {
+	baseTemplateData
+	Note Note
+	From int
+	To   int
+	Ops  []DiffOp
+}
+
+// every stored version of each note keyed by note ID, oldest first, guarded by mu.
+// Revision numbers start at 1, so revision n is noteHistory[id][n-1].
+var noteHistory = make(map[string][]Note)
+
+// maxRevisions is how many revisions of each note are kept. Past it the oldest are
+// dropped and the rest renumbered from 1, as compaction does.
+const maxRevisions = 100
+
+// recordRevision appends a note as its newest revision, unless its title, content and
+// tags are those of the newest one already: writes that only touch other fields, like
+// locking it or counting a view, aren't revisions. The caller must hold mu.
+func recordRevision(note Note) {
+	revisions := noteHistory[note.ID]
+	if n := len(revisions); n > 0 && sameText(revisions[n-1], note) {
+		return
+	}
+	if extra := len(revisions) + 1 - maxRevisions; extra > 0 {
+		// a copy, since diffNote may still be reading the old slice
+		revisions = append([]Note(nil), revisions[extra:]...)
+	}
+	noteHistory[note.ID] = append(revisions, note)
+}
+
+// sameText reports whether two versions of a note have the same title, content and tags.
+func sameText(a, b Note) bool {
+	return a.Title == b.Title && a.Content == b.Content && slices.Equal(a.Tags, b.Tags)
+}
+
+// diff handler
+// ------------
+func (s *ApiServer) diffNote(w http.ResponseWriter, r *http.Request) error {
+	id := extractID(r.URL.Path)
+
+	mu.Lock()
+	note, exists := notes[id]
+	revisions := noteHistory[id]
+	mu.Unlock()
+
+	if !exists {
+		return s.notFoundPage(w, "Note not found")
+	}
+
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil || from < 1 || from > len(revisions) {
+		return WriteHTML(w, http.StatusBadRequest, templates, "error.html", s.errorPage("invalid from revision"))
+	}
+	to, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil || to < 1 || to > len(revisions) {
+		return WriteHTML(w, http.StatusBadRequest, templates, "error.html", s.errorPage("invalid to revision"))
+	}
+
+	return WriteHTML(w, http.StatusOK, templates, "diff.html", DiffPage{
+		baseTemplateData: s.baseData(),
+		Note:             note,
+		From:             from,
+		To:               to,
+		Ops:              diffWords(revisions[from-1].Content, revisions[to-1].Content),
+	})
+}
+
+// diff
+// ----
+var wordPattern = regexp.MustCompile(`\s+|\S+`)
+
+// maxDiffCells bounds the LCS table so a huge rewrite can't eat all the memory.
+// Past it the changed middle is shown as one deletion and one insertion.
+const maxDiffCells = 4_000_000
+
+// diffWords returns a word level diff from a to b. Whitespace runs are kept as their own
+// tokens so the output keeps the original line breaks.
+func diffWords(a, b string) []DiffOp {
+	x := wordPattern.FindAllString(a, -1)
+	y := wordPattern.FindAllString(b, -1)
+
+	// the common prefix and suffix are cheap to find and usually most of an edit
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+
+	var ops []DiffOp
+	ops = appendOp(ops, "equal", x[:prefix]...)
+
+	mx, my := x[prefix:len(x)-suffix], y[prefix:len(y)-suffix]
+	if len(mx)*len(my) > maxDiffCells {
+		ops = appendOp(ops, "delete", mx...)
+		ops = appendOp(ops, "insert", my...)
+	} else {
+		ops = appendLCSDiff(ops, mx, my)
+	}
+
+	return appendOp(ops, "equal", x[len(x)-suffix:]...)
+}
+
+// appendLCSDiff diffs x and y using a longest common subsequence table.
+func appendLCSDiff(ops []DiffOp, x, y []string) []DiffOp {
+	// lcs[i][j] is the length of the LCS of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			ops = appendOp(ops, "equal", x[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = appendOp(ops, "delete", x[i])
+			i++
+		default:
+			ops = appendOp(ops, "insert", y[j])
+			j++
+		}
+	}
+	ops = appendOp(ops, "delete", x[i:]...)
+	return appendOp(ops, "insert", y[j:]...)
+}
+
+// appendOp adds tokens to the diff, merging them into the last op when it is the same kind.
+func appendOp(ops []DiffOp, kind string, tokens ...string) []DiffOp {
+	for _, token := range tokens {
+		if n := len(ops); n > 0 && ops[n-1].Kind == kind {
+			ops[n-1].Text += token
+			continue
+		}
+		ops = append(ops, DiffOp{Kind: kind, Text: token})
+	}
+	return ops
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecordRevision(t *testing.T) {
+	base := Note{ID: "1", Title: "Title", Content: "content", Tags: []string{"a"}, Created: time.Now()}
+	with := func(change func(*Note)) Note {
+		note := base
+		change(&note)
+		return note
+	}
+
+	tests := []struct {
+		name   string
+		writes []Note
+		want   int
+	}{
+		{"first write", nil, 1},
+		{"new content", []Note{with(func(n *Note) { n.Content = "edited" })}, 2},
+		{"new title", []Note{with(func(n *Note) { n.Title = "Renamed" })}, 2},
+		{"new tags", []Note{with(func(n *Note) { n.Tags = []string{"a", "b"} })}, 2},
+		{"locked only", []Note{with(func(n *Note) { n.Locked = true })}, 1},
+		{"trusted and styled only", []Note{with(func(n *Note) { n.Trusted, n.CSSClass = true, "wide" })}, 1},
+		{"same text again", []Note{base, base}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestServer(t)
+			storeTestNote(base)
+			for _, note := range tt.writes {
+				storeTestNote(note)
+			}
+			if got := len(noteHistory["1"]); got != tt.want {
+				t.Errorf("%d revisions, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordRevisionCap(t *testing.T) {
+	newTestServer(t)
+	for i := 1; i <= maxRevisions+5; i++ {
+		storeTestNote(Note{ID: "1", Title: "Title", Content: fmt.Sprint("version ", i)})
+	}
+
+	revisions := noteHistory["1"]
+	if len(revisions) != maxRevisions {
+		t.Fatalf("%d revisions, want %d", len(revisions), maxRevisions)
+	}
+	if first, last := revisions[0].Content, revisions[len(revisions)-1].Content; first != "version 6" || last != fmt.Sprint("version ", maxRevisions+5) {
+		t.Errorf("revisions run from %q to %q, want the newest %d", first, last, maxRevisions)
+	}
+
+	mu.Lock()
+	removeNote("1")
+	mu.Unlock()
+	if _, ok := noteHistory["1"]; ok {
+		t.Error("the history outlived the note")
+	}
+}
+
+func TestDiffWords(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []DiffOp
+	}{
+		{"both empty", "", "", nil},
+		{"from empty", "", "new words", []DiffOp{{"insert", "new words"}}},
+		{"to empty", "old words", "", []DiffOp{{"delete", "old words"}}},
+		{"unchanged", "same text", "same text", []DiffOp{{"equal", "same text"}}},
+		{"insert", "the cat", "the black cat", []DiffOp{{"equal", "the "}, {"insert", "black "}, {"equal", "cat"}}},
+		{"delete", "the black cat", "the cat", []DiffOp{{"equal", "the "}, {"delete", "black "}, {"equal", "cat"}}},
+		{"replace", "the black cat", "the white cat", []DiffOp{{"equal", "the "}, {"delete", "black"}, {"insert", "white"}, {"equal", " cat"}}},
+		{"keeps line breaks", "one\ntwo", "one\nthree", []DiffOp{{"equal", "one\n"}, {"delete", "two"}, {"insert", "three"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffWords(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffWords(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// WithIdleShutdown makes the server stop itself once no request has been handled for
+// timeout, for demo deployments that should go away when nobody uses them. Zero, the
+// default, keeps the server running.
+func WithIdleShutdown(timeout time.Duration) ServerOption {
+	return func(s *ApiServer) {
+		s.idleTimeout = timeout
+	}
+}
+
+// activity is when the last request started and how many are still being handled.
+type activity struct {
+	last     atomic.Int64 // unix nanoseconds
+	inFlight atomic.Int64
+}
+
+// withActivity keeps track of requests for the idle shutdown. It is only installed when
+// idle shutdown is on.
+func (s *ApiServer) withActivity(next http.Handler) http.Handler {
+	if s.idleTimeout <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.activity.last.Store(time.Now().UnixNano())
+		s.activity.inFlight.Add(1)
+		defer s.activity.inFlight.Add(-1)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// watchIdle stops the server once it has been idle for the idle timeout. The timer is
+// re-armed for the remaining time whenever a request came in since it was set, and the
+// server never counts as idle while a request is still being handled.
+func (s *ApiServer) watchIdle() {
+	s.activity.last.Store(time.Now().UnixNano())
+
+	timer := time.NewTimer(s.idleTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-timer.C:
+			idle := time.Since(time.Unix(0, s.activity.last.Load()))
+			if idle < s.idleTimeout || s.activity.inFlight.Load() > 0 {
+				timer.Reset(s.idleTimeout - idle)
+				continue
+			}
+
+			log.Printf("no requests for %s, shutting down", idle.Round(time.Second))
+			if err := s.Stop(context.Background()); err != nil {
+				log.Println("idle shutdown:", err)
+			}
+			return
+		}
+	}
+}
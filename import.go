@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type ImportResult struct {
+	Imported int `json:"imported"`
+
+	// Warnings lists the files a Markdown import skipped, and why
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// importedNote is a note as an import file has it. Exports made before Note had JSON
+// names wrote ExpiresAt, Trusted and IsTemplate, which don't match expires_at, trusted
+// and is_template, so those are read under their old names too. The other fields only
+// changed case, which encoding/json ignores.
+type importedNote struct {
+	Note
+	LegacyExpiresAt  *time.Time `json:"ExpiresAt"`
+	LegacyTrusted    bool       `json:"Trusted"`
+	LegacyIsTemplate bool       `json:"IsTemplate"`
+}
+
+// note returns the imported note, with the fields it had under their old names.
+func (n importedNote) note() Note {
+	note := n.Note
+	if note.ExpiresAt == nil {
+		note.ExpiresAt = n.LegacyExpiresAt
+	}
+	note.Trusted = note.Trusted || n.LegacyTrusted
+	note.IsTemplate = note.IsTemplate || n.LegacyIsTemplate
+	return note
+}
+
+// maxImportNotes is the most notes one import may carry.
+const maxImportNotes = 1000
+
+// maxImportBody is the largest body an import may be sent in: maxImportNotes notes of
+// the longest content, so an import can't make the server buffer any amount of data.
+func (s *ApiServer) maxImportBody() int64 {
+	return s.maxNoteBody() * maxImportNotes
+}
+
+// importHandler loads notes in the format /export writes, so an export can be restored
+// here or moved to another instance. Notes keep their IDs, prefixes included, and replace
+// any note with the same ID; a note without an ID gets a new one. Only an admin can
+// replace a read-only note or one someone is editing, or import notes read-only or as
+// templates. The whole import is validated first and applied in one transaction, so it
+// either all lands or none of it.
+func (s *ApiServer) importHandler(w http.ResponseWriter, r *http.Request) error {
+	var imported []importedNote
+	body := http.MaxBytesReader(nil, r.Body, s.maxImportBody())
+	if err := json.NewDecoder(body).Decode(&imported); err != nil {
+		return WriteJSON(r, w, decodeStatus(err), ApiError{Error: "invalid import: " + err.Error()})
+	}
+	if len(imported) > maxImportNotes {
+		return WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: fmt.Sprintf("too many notes: %d, the limit is %d", len(imported), maxImportNotes)})
+	}
+	list := make([]Note, len(imported))
+	for i, note := range imported {
+		list[i] = note.note()
+	}
+
+	admin := s.isAdmin(r)
+	now := time.Now()
+	for i := range list {
+		note := &list[i]
+		if note.ID == "" {
+			note.ID = s.generateID()
+		} else if !isValidID(note.ID) {
+			return WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: fmt.Sprintf("note %d: invalid id %q", i, note.ID)})
+		}
+
+		note.Title = sanitizeContent(note.Title)
+		note.Content = sanitizeContent(note.Content)
+		note.Tags = cleanTags(note.Tags)
+		if note.Created.IsZero() {
+			note.Created = now
+		}
+		// trusting content, protecting a note and offering it as a template are admin
+		// decisions, an import file can't make them
+		note.Trusted = note.Trusted && admin
+		note.Locked = note.Locked && admin
+		note.IsTemplate = note.IsTemplate && admin
+
+		if err := s.validateNote(*note); err != nil {
+			return WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: fmt.Sprintf("note %d: %s", i, err)})
+		}
+	}
+
+	return s.storeImport(w, r, list, nil)
+}
+
+// storeImport puts the validated notes in one transaction, unless they would take the
+// server over its note limit or replace a note that is protected from the caller, and
+// answers with an ImportResult.
+func (s *ApiServer) storeImport(w http.ResponseWriter, r *http.Request, list []Note, warnings []string) error {
+	admin := s.isAdmin(r)
+	full := false
+	var refused *ApiError
+	status := 0
+	err := store.WithTx(func(tx Tx) error {
+		for _, note := range list {
+			if existing, ok := tx.Get(note.ID); ok && !admin {
+				if existing.Locked {
+					status, refused = http.StatusForbidden, &ApiError{Error: fmt.Sprintf("note %s: %s", note.ID, errReadOnly)}
+					return errRollback
+				}
+				// an import carries no lock token, so it cannot replace a note someone is editing
+				if _, held := s.activeLock(note.ID); held {
+					status, refused = http.StatusLocked, &ApiError{Error: fmt.Sprintf("note %s: Note is locked by another editor", note.ID)}
+					return errRollback
+				}
+			}
+			tx.Put(note)
+		}
+		if s.maxTotalNotes > 0 && tx.Count() > s.maxTotalNotes {
+			full = true
+			return errRollback
+		}
+		return nil
+	})
+	if refused != nil {
+		return WriteJSON(r, w, status, *refused)
+	}
+	if full {
+		return WriteJSON(r, w, http.StatusInsufficientStorage, ApiError{Error: errNoteLimit(s.maxTotalNotes).Error()})
+	}
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(r, w, http.StatusOK, ImportResult{Imported: len(list), Warnings: warnings})
+}
+
+// markdownImportHandler creates a note from each .md file uploaded as multipart form
+// data, e.g. to move notes over from a file based notes app. The file name without its
+// extension becomes the title and the file the content. Empty files and files that
+// aren't Markdown are skipped with a warning. The rest are validated first and stored in
+// one transaction, like a JSON import.
+func (s *ApiServer) markdownImportHandler(w http.ResponseWriter, r *http.Request) error {
+	// parseForm caps the files like any form field, the reader caps their total size,
+	// which would otherwise only be bounded by the disk the temp files go to
+	r.Body = http.MaxBytesReader(nil, r.Body, s.maxImportBody())
+	if err := s.parseForm(r); err != nil {
+		return WriteJSON(r, w, decodeStatus(err), ApiError{Error: "invalid upload: " + err.Error()})
+	}
+	if r.MultipartForm == nil {
+		return WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: "invalid upload, send the files as multipart/form-data"})
+	}
+
+	var list []Note
+	warnings := make([]string, 0)
+	now := time.Now()
+	// in field order, so the notes are created in a predictable order
+	fields := make([]string, 0, len(r.MultipartForm.File))
+	for field := range r.MultipartForm.File {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		for _, file := range r.MultipartForm.File[field] {
+			name := filepath.Base(file.Filename)
+			ext := strings.ToLower(filepath.Ext(name))
+			if ext != ".md" && ext != ".markdown" {
+				warnings = append(warnings, fmt.Sprintf("%s: skipped, not a Markdown file", name))
+				continue
+			}
+
+			content, err := s.readUpload(file)
+			if err != nil {
+				return WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: fmt.Sprintf("%s: %s", name, err)})
+			}
+			if strings.TrimSpace(content) == "" {
+				warnings = append(warnings, fmt.Sprintf("%s: skipped, the file is empty", name))
+				continue
+			}
+
+			note := Note{
+				ID:      s.generateID(),
+				Title:   sanitizeContent(strings.TrimSuffix(name, filepath.Ext(name))),
+				Content: content,
+				Created: now,
+			}
+			if err := s.validateNote(note); err != nil {
+				return WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: fmt.Sprintf("%s: %s", name, err)})
+			}
+			list = append(list, note)
+		}
+	}
+
+	return s.storeImport(w, r, list, warnings)
+}
+
+// readUpload returns the sanitized text of an uploaded file. It reads no more than a note
+// can hold, validateNote rejects a file that was cut off.
+func (s *ApiServer) readUpload(file *multipart.FileHeader) (string, error) {
+	f, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	body, err := io.ReadAll(io.LimitReader(f, int64(s.maxContentLength)*utf8.UTFMax+1))
+	if err != nil {
+		return "", err
+	}
+	return sanitizeContent(string(body)), nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportLimits(t *testing.T) {
+	// importOf returns an import of n notes
+	importOf := func(n int) string {
+		list := make([]string, n)
+		for i := range list {
+			list[i] = fmt.Sprintf(`{"id": "n%d", "title": "t", "content": "c"}`, i)
+		}
+		return "[" + strings.Join(list, ",") + "]"
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"at the note limit", importOf(maxImportNotes), http.StatusOK},
+		{"too many notes", importOf(maxImportNotes + 1), http.StatusBadRequest},
+		{"oversized body", `[{"title": "t", "content": "` + strings.Repeat("a", 66<<20) + `"}]`, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// with content of at most 10 characters, an import body can't reach 66MiB
+			_, h := newTestServer(t, WithMaxContentLength(10))
+			w := serve(h, "POST", "/import", tt.body, "Content-Type", "application/json")
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %.200s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestImportKeyNames(t *testing.T) {
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	at := expires.Format(time.RFC3339)
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"current", `[{"id": "1", "title": "t", "content": "c", "expires_at": "` + at + `", "trusted": true, "is_template": true}]`},
+		{"before the JSON names", `[{"ID": "1", "Title": "t", "Content": "c", "ExpiresAt": "` + at + `", "Trusted": true, "IsTemplate": true}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t, WithAdminToken("admin"))
+			w := serve(h, "POST", "/import", tt.body, "Content-Type", "application/json", "Authorization", "Bearer admin")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+
+			note := notes["1"]
+			if note.ExpiresAt == nil || !note.ExpiresAt.Equal(expires) || !note.Trusted || !note.IsTemplate {
+				t.Errorf("imported %+v, want it to expire at %s, trusted and a template", note, expires)
+			}
+		})
+	}
+}
+
+// markdownUpload returns a multipart body with a file per name, each holding content, and
+// its content type.
+func markdownUpload(t *testing.T, content string, names ...string) (string, string) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, name := range names {
+		fw, err := mw.CreateFormFile("files", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, content)
+	}
+	mw.Close()
+	return body.String(), mw.FormDataContentType()
+}
+
+func TestMarkdownImportLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		files   []string
+		want    int
+		notes   int
+	}{
+		{"within the limits", "# hi", []string{"a.md", "b.md"}, http.StatusOK, 2},
+		{"more files than form fields", "# hi", []string{"a.md", "b.md", "c.md"}, http.StatusBadRequest, 0},
+		{"oversized upload", strings.Repeat("a", 66<<20), []string{"a.md"}, http.StatusRequestEntityTooLarge, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// with content of at most 10 characters, an upload can't reach 66MiB
+			_, h := newTestServer(t, WithMaxContentLength(10), WithMaxFormFields(2))
+			body, contentType := markdownUpload(t, tt.content, tt.files...)
+			w := serve(h, "POST", "/import/markdown", body, "Content-Type", contentType)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %.200s", w.Code, tt.want, w.Body)
+			}
+			if len(notes) != tt.notes {
+				t.Errorf("%d notes stored, want %d", len(notes), tt.notes)
+			}
+		})
+	}
+}
+
+func TestMarkdownImportNotMultipart(t *testing.T) {
+	_, h := newTestServer(t)
+	w := serve(h, "POST", "/import/markdown", "title=t", "Content-Type", "application/x-www-form-urlencoded")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+	}
+}
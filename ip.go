@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// WithTrustProxy makes clientIP read X-Forwarded-For. Only enable this behind a proxy
+// that sets the header, otherwise clients can spoof their address.
+func WithTrustProxy(trust bool) ServerOption {
+	return func(s *ApiServer) {
+		s.trustProxy = trust
+	}
+}
+
+// clientIP returns the address of the client that made the request.
+// IP-based features (rate limits, quotas, logging) should use this instead of reading RemoteAddr.
+func (s *ApiServer) clientIP(r *http.Request) string {
+	if s.trustProxy {
+		for _, part := range strings.Split(r.Header.Get("X-Forwarded-For"), ",") {
+			addr, err := netip.ParseAddr(strings.TrimSpace(part))
+			if err == nil && isPublicIP(addr) {
+				return addr.String()
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func isPublicIP(addr netip.Addr) bool {
+	return addr.IsGlobalUnicast() && !addr.IsPrivate()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"html"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// refPattern matches a [[note-id]] reference to another note.
+var refPattern = regexp.MustCompile(`\[\[([A-Za-z0-9_-]{1,52})\]\]`)
+
+// the reference index, guarded by mu: the ids each note references, and for each
+// referenced id the notes that reference it. A reference to a note that doesn't exist
+// stays indexed, so it turns into a backlink if the note is created (or imported) later.
+var (
+	noteRefs  = make(map[string][]string)
+	backlinks = make(map[string]map[string]bool)
+)
+
+// scanReferences returns the distinct note ids referenced in content, in order.
+func scanReferences(content string) []string {
+	var refs []string
+	seen := make(map[string]bool)
+	for _, match := range refPattern.FindAllStringSubmatch(content, -1) {
+		if id := match[1]; !seen[id] {
+			seen[id] = true
+			refs = append(refs, id)
+		}
+	}
+	return refs
+}
+
+// indexReferences replaces the note's entries in the reference index with the ones in
+// its current content. The caller must hold mu.
+func indexReferences(note Note) {
+	unindexReferences(note.ID)
+
+	refs := scanReferences(note.Content)
+	if len(refs) == 0 {
+		return
+	}
+	noteRefs[note.ID] = refs
+	for _, target := range refs {
+		if backlinks[target] == nil {
+			backlinks[target] = make(map[string]bool)
+		}
+		backlinks[target][note.ID] = true
+	}
+}
+
+// unindexReferences drops the references a note makes. The caller must hold mu.
+func unindexReferences(id string) {
+	for _, target := range noteRefs[id] {
+		delete(backlinks[target], id)
+		if len(backlinks[target]) == 0 {
+			delete(backlinks, target)
+		}
+	}
+	delete(noteRefs, id)
+}
+
+// linkedContent renders content for the note view: escaped, apart from the allowed
+// inline tags, and with each [[note-id]] reference turned into a link.
+func linkedContent(content string, allowed map[string]bool) template.HTML {
+	return template.HTML(sanitizeHTML(content, allowed, linkReferences))
+}
+
+// linkReferences escapes text for HTML and turns each [[note-id]] reference into a link
+// to the note, titled with the note's title. A reference to a note that doesn't exist is
+// rendered as a broken link.
+func linkReferences(content string) string {
+	now := time.Now()
+	var b strings.Builder
+	last := 0
+
+	mu.Lock()
+	for _, loc := range refPattern.FindAllStringSubmatchIndex(content, -1) {
+		b.WriteString(html.EscapeString(content[last:loc[0]]))
+		id := content[loc[2]:loc[3]]
+		if note, exists := notes[id]; exists && !note.expired(now) {
+			href := "/notes/" + id + "/" + url.PathEscape(note.Slug())
+			b.WriteString(`<a class="note-link" href="` + html.EscapeString(href) + `">` + html.EscapeString(note.Title) + `</a>`)
+		} else {
+			b.WriteString(`<a class="note-link broken" href="/notes/` + html.EscapeString(id) + `" title="no such note">` + html.EscapeString(content[loc[0]:loc[1]]) + `</a>`)
+		}
+		last = loc[1]
+	}
+	mu.Unlock()
+
+	b.WriteString(html.EscapeString(content[last:]))
+	return b.String()
+}
+
+// backlinks handler
+// -----------------
+// backlinksNote lists the notes that reference a note, newest first.
+func (s *ApiServer) backlinksNote(w http.ResponseWriter, r *http.Request) error {
+	id := extractID(r.URL.Path)
+	now := time.Now()
+
+	mu.Lock()
+	_, exists := notes[id]
+	list := make([]Note, 0, len(backlinks[id]))
+	for source := range backlinks[id] {
+		if note, ok := notes[source]; ok && !note.expired(now) {
+			list = append(list, note)
+		}
+	}
+	mu.Unlock()
+
+	if !exists {
+		if wantsJSON(r) {
+			return WriteJSON(r, w, http.StatusNotFound, ApiError{Error: "Note not found"})
+		}
+		return s.notFoundPage(w, "Note not found")
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Created.After(list[j].Created)
+	})
+
+	if wantsJSON(r) {
+		return WriteJSON(r, w, http.StatusOK, list)
+	}
+
+	return WriteHTML(w, http.StatusOK, templates, "list.html", ListPage{
+		baseTemplateData: s.baseData(),
+		Notes:            s.listItems(list),
+		Starred:          starredNotes(readSession(r)),
+	})
+}
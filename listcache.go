@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+)
+
+// listCache holds the rendered HTML of the default /notes page, guarded by mu. Any change
+// to the notes bumps gen and drops it; a render that raced with a change isn't stored.
+var listCache struct {
+	body  []byte
+	valid bool
+	gen   uint64
+
+	// expires is when the first listed note expires and the page goes stale on its own
+	expires time.Time
+}
+
+// invalidateListCache drops the cached list page. The caller must hold mu.
+func invalidateListCache() {
+	listCache.body = nil
+	listCache.valid = false
+	listCache.gen++
+}
+
+// cacheableList reports whether a list request is for the canonical default view: plain
+// HTML with no query parameters, from a visitor without stars to mark.
+func cacheableList(r *http.Request) bool {
+	return r.URL.RawQuery == "" && !wantsJSON(r) && len(starredNotes(readSession(r))) == 0
+}
+
+// cachedList returns the cached list page and whether it is still fresh.
+func cachedList(now time.Time) ([]byte, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !listCache.valid || (!listCache.expires.IsZero() && !now.Before(listCache.expires)) {
+		return nil, false
+	}
+	return listCache.body, true
+}
+
+// listCacheGen returns the current cache generation. The caller must hold mu.
+func listCacheGen() uint64 {
+	return listCache.gen
+}
+
+// storeListCache caches body, rendered from the notes as of generation gen, unless the
+// notes have changed since.
+func storeListCache(gen uint64, body []byte, expires time.Time) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if gen != listCache.gen {
+		return
+	}
+	listCache.body = body
+	listCache.valid = true
+	listCache.expires = expires
+}
+
+// renderHTML renders the page tmplName inside the base.html layout into memory.
+func renderHTML(tmplName string, data any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := templates[tmplName].ExecuteTemplate(&buf, "base.html", data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeHTMLBytes writes an already rendered page.
+func writeHTMLBytes(w http.ResponseWriter, status int, body []byte) error {
+	return WriteBytes(w, status, "text/html", body)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListCacheInvalidation(t *testing.T) {
+	form := []string{"Content-Type", "application/x-www-form-urlencoded"}
+	tests := []struct {
+		name   string
+		change func(h http.Handler)
+		want   string // on the list page after the change
+		gone   string // no longer on it
+	}{
+		{"create", func(h http.Handler) {
+			serve(h, "POST", "/notes", "title=Brand+new&content=x", form...)
+		}, "Brand new", ""},
+		{"update", func(h http.Handler) {
+			serve(h, "PUT", "/notes/1", "title=Renamed&content=x", form...)
+		}, "Renamed", "Cached title"},
+		{"delete", func(h http.Handler) {
+			serve(h, "DELETE", "/notes/1", "")
+		}, "", "Cached title"},
+		{"store transaction", func(http.Handler) {
+			store.WithTx(func(tx Tx) error {
+				tx.Put(Note{ID: "2", Title: "Through a tx", Created: time.Now()})
+				return nil
+			})
+		}, "Through a tx", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t)
+			storeTestNote(Note{ID: "1", Title: "Cached title", Content: "x", Created: time.Now()})
+
+			if w := serve(h, "GET", "/notes", ""); !strings.Contains(w.Body.String(), "Cached title") {
+				t.Fatalf("list page doesn't show the note: %s", w.Body)
+			}
+			if _, fresh := cachedList(time.Now()); !fresh {
+				t.Fatal("the list page wasn't cached")
+			}
+
+			tt.change(h)
+			if _, fresh := cachedList(time.Now()); fresh {
+				t.Error("the cached page survived the change")
+			}
+
+			body := serve(h, "GET", "/notes", "").Body.String()
+			if tt.want != "" && !strings.Contains(body, tt.want) {
+				t.Errorf("list page doesn't show %q after the change", tt.want)
+			}
+			if tt.gone != "" && strings.Contains(body, tt.gone) {
+				t.Errorf("list page still shows %q after the change", tt.gone)
+			}
+		})
+	}
+}
+
+func TestListCacheExpiry(t *testing.T) {
+	_, h := newTestServer(t)
+	expires := time.Now().Add(time.Hour)
+	storeTestNote(Note{ID: "1", Title: "Short lived", Content: "x", Created: time.Now(), ExpiresAt: &expires})
+
+	serve(h, "GET", "/notes", "")
+	if _, fresh := cachedList(time.Now()); !fresh {
+		t.Fatal("the list page wasn't cached")
+	}
+	if _, fresh := cachedList(expires); fresh {
+		t.Error("the cached page is still fresh once a listed note expired")
+	}
+}
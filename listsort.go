@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sortCookie remembers the list order a client last asked for.
+const sortCookie = "sort"
+
+// noteSorts are the list orders ?sort= accepts. Each runs with mu held.
+var noteSorts = map[string]func(list []Note){
+	"created_desc": sortByCreated,
+	"created_asc": func(list []Note) {
+		sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	},
+	"title": func(list []Note) {
+		sort.Slice(list, func(i, j int) bool { return strings.ToLower(list[i].Title) < strings.ToLower(list[j].Title) })
+	},
+	"views_desc": func(list []Note) {
+		sortByCreated(list)
+		sortByViews(list)
+	},
+}
+
+// sortByCreated orders notes newest first.
+func sortByCreated(list []Note) {
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.After(list[j].Created) })
+}
+
+// WithDefaultSort sets the list order for clients that haven't chosen one.
+func WithDefaultSort(name string) ServerOption {
+	return func(s *ApiServer) {
+		s.defaultSort = name
+	}
+}
+
+// listSort returns the order to list notes in: an explicit ?sort=, which is remembered in
+// a cookie for next time, else the remembered one, else the server default. Unknown
+// values are ignored.
+func (s *ApiServer) listSort(w http.ResponseWriter, r *http.Request) string {
+	if name := r.URL.Query().Get("sort"); noteSorts[name] != nil {
+		http.SetCookie(w, &http.Cookie{
+			Name:     sortCookie,
+			Value:    name,
+			Path:     "/",
+			MaxAge:   int((365 * 24 * time.Hour).Seconds()),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		return name
+	}
+	if cookie, err := r.Cookie(sortCookie); err == nil && noteSorts[cookie.Value] != nil {
+		return cookie.Value
+	}
+	return s.defaultSort
+}
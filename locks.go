@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// types
+// -----
+// editLock is an advisory lock a client takes out on a note while editing it.
+type editLock struct {
+	Token    string
+	Acquired time.Time
+}
+
+type LockResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// edit locks keyed by note ID, guarded by mu
+var editLocks = make(map[string]editLock)
+
+// WithLockTimeout sets how long an edit lock is held before it expires on its own.
+func WithLockTimeout(d time.Duration) ServerOption {
+	return func(s *ApiServer) {
+		s.lockTimeout = d
+	}
+}
+
+// activeLock returns the lock on a note if there is one that has not expired.
+// Expired locks are dropped. The caller must hold mu.
+func (s *ApiServer) activeLock(id string) (editLock, bool) {
+	lock, ok := editLocks[id]
+	if !ok {
+		return editLock{}, false
+	}
+	if time.Since(lock.Acquired) >= s.lockTimeout {
+		delete(editLocks, id)
+		return editLock{}, false
+	}
+	return lock, true
+}
+
+// lockToken reads the lock token a client presents, from the X-Lock-Token header or the lock_token form value.
+func lockToken(r *http.Request) string {
+	if token := r.Header.Get("X-Lock-Token"); token != "" {
+		return token
+	}
+	return r.FormValue("lock_token")
+}
+
+// protectNote makes a note read-only until it is unlocked with /unlock.
+func (s *ApiServer) protectNote(w http.ResponseWriter, r *http.Request) error {
+	id := extractID(r.URL.Path)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	note, exists := notes[id]
+	if !exists {
+		return WriteJSON(r, w, http.StatusNotFound, ApiError{Error: "Note not found"})
+	}
+
+	if !note.Locked {
+		note.Locked = true
+		note = putNote(note)
+	}
+
+	if wantsJSON(r) {
+		return WriteJSON(r, w, http.StatusOK, note)
+	}
+	http.Redirect(w, r, "/notes/"+id, http.StatusFound)
+	return nil
+}
+
+func newLockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// errReadOnly is the error for a change to a protected note.
+const errReadOnly = "Note is read-only, unlock it first"
+
+// lock handlers
+// -------------
+// lockNote takes out (or renews, for the current holder) the edit lock on a note.
+func (s *ApiServer) lockNote(w http.ResponseWriter, r *http.Request) error {
+	id := extractID(r.URL.Path)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, exists := notes[id]; !exists {
+		return WriteJSON(r, w, http.StatusNotFound, ApiError{Error: "Note not found"})
+	}
+
+	token := lockToken(r)
+	if lock, held := s.activeLock(id); held && lock.Token != token {
+		return WriteJSON(r, w, http.StatusLocked, ApiError{Error: "Note is locked by another editor"})
+	}
+
+	if token == "" {
+		var err error
+		if token, err = newLockToken(); err != nil {
+			return err
+		}
+	}
+
+	lock := editLock{Token: token, Acquired: time.Now()}
+	editLocks[id] = lock
+
+	return WriteJSON(r, w, http.StatusOK, LockResponse{Token: token, ExpiresAt: lock.Acquired.Add(s.lockTimeout)})
+}
+
+// unlockNote releases the edit lock on a note and makes it writable again if it was
+// protected. Only the lock holder can release an edit lock.
+func (s *ApiServer) unlockNote(w http.ResponseWriter, r *http.Request) error {
+	id := extractID(r.URL.Path)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	note, exists := notes[id]
+	if !exists {
+		return WriteJSON(r, w, http.StatusNotFound, ApiError{Error: "Note not found"})
+	}
+
+	if lock, held := s.activeLock(id); held {
+		if lock.Token != lockToken(r) {
+			return WriteJSON(r, w, http.StatusLocked, ApiError{Error: "Note is locked by another editor"})
+		}
+		delete(editLocks, id)
+	}
+
+	if note.Locked {
+		note.Locked = false
+		putNote(note)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
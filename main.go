@@ -1,52 +1,583 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"html/template"
 	"log"
+	"mime"
 	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
-	"text/template"
+	"sync/atomic"
+	"syscall"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/a-h/templ"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // types
 // -----
 type Note struct {
-	ID      string
-	Title   string
-	Content string
-	Created time.Time
+	ID        string     `json:"id"`
+	Title     string     `json:"title"`
+	Content   string     `json:"content"`
+	Created   time.Time  `json:"created"`
+	Updated   time.Time  `json:"updated"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	Tags      []string   `json:"tags"`
+
+	// Trusted notes render their content as raw HTML. Only an admin can set it, and
+	// updating the content clears it.
+	Trusted bool `json:"trusted"`
+
+	// IsTemplate notes are starting points for new notes, kept out of the normal list
+	IsTemplate bool `json:"is_template"`
+
+	// Locked notes are read-only until unlocked. Unlike an edit lock it doesn't expire or
+	// belong to anyone, and only /protect and /unlock change it.
+	Locked bool `json:"locked"`
+
+	// CSSClass is added to the class of the note's container on its page, to style single
+	// notes. It is one class name, see cssClassPattern, or empty.
+	CSSClass string `json:"css_class"`
 }
 
 // NOTE: we could omit the error return value, but then we would need to handle the errors in the handler function...and I don't like that. the HandleFunc from net/http does not return an error, so we need to wrap it in a function that does return an error! So we are going to make a mapping type:
 type ApiFunc func(w http.ResponseWriter, r *http.Request) error
 
 type ApiServer struct {
-	listAddr string
+	listAddr      string
+	sweepInterval time.Duration
+	trustProxy    bool
+	lockTimeout   time.Duration
+	draftTimeout  time.Duration
+
+	// shutdownTimeout is how long Stop waits for in-flight requests before dropping them
+	shutdownTimeout time.Duration
+
+	// maxHeaderBytes bounds the size of request headers, larger ones get a 431
+	maxHeaderBytes int
+
+	// banner is shown at the top of the index and list pages when set
+	banner string
+
+	// listTitleLength and listContentLength cut the list page's previews, 0 turns one off
+	listTitleLength   int
+	listContentLength int
+
+	// emptyListMessage is shown on the list page while there are no notes at all
+	emptyListMessage string
+
+	// siteTitle and favicon brand every page, so several instances are easy to tell apart
+	siteTitle string
+	favicon   string
+
+	// debugBodies logs request bodies, for local debugging only
+	debugBodies bool
+
+	// maxContentLength is the most characters a note's content may have
+	maxContentLength int
+
+	// trimContent strips surrounding whitespace from submitted titles and content
+	trimContent bool
+
+	// maxTotalNotes caps how many notes are stored, 0 for no cap
+	maxTotalNotes int
+	// maxFormFields caps how many values a form may have, 0 for no cap
+	maxFormFields int
+	// overrideMethods are the methods a POST may be overridden to, none turns it off
+	overrideMethods map[string]bool
+
+	// tracerProvider traces requests when set
+	tracerProvider trace.TracerProvider
+
+	// createWebhook is sent every note created through POST /notes, when set
+	createWebhook string
+	webhookClient *http.Client
+	// webhookSecret signs webhook bodies when set
+	webhookSecret string
+	// fetchClient fetches pages for POST /notes/from-url, nil while that's turned off
+	fetchClient   *http.Client
+	fetchMaxBytes int64
+
+	// the webhook is quiet between these times of day in webhookQuietLoc, unless they are equal
+	webhookQuietStart time.Duration
+	webhookQuietEnd   time.Duration
+	webhookQuietLoc   *time.Location
+
+	// maxTags and maxTagLength keep tag lists short enough to display
+	maxTags      int
+	maxTagLength int
+
+	// defaultTags are given to new notes without tags, or to all new notes with alwaysDefaultTags
+	defaultTags       []string
+	alwaysDefaultTags bool
+
+	// autoTitle names untitled new notes after the first line of their content
+	autoTitle bool
+
+	// allowedTags are the inline HTML tags kept in rendered note content, see inlineTags
+	allowedTags map[string]bool
+
+	// normalizeSearch makes /search and /suggest ignore accents as well as case
+	normalizeSearch bool
+	// searchSort is the order /search lists results in unless ?sort= picks one
+	searchSort string
+
+	// countViews counts page views of each note
+	countViews bool
+
+	// defaultSort is the list order for clients that haven't picked one, see noteSorts
+	defaultSort string
+	// defaultRepresentation is "html" or "json", what clients with an ambiguous Accept get
+	defaultRepresentation string
+
+	// idPrefix starts every new note ID, to tell apart notes from several instances
+	idPrefix string
+	// lastID is the number of the last ID generateID handed out
+	lastID atomic.Int64
+
+	// metrics are served on /metrics, with histograms bucketed by these bounds
+	metrics         *metrics
+	durationBuckets []float64
+	sizeBuckets     []float64
+
+	// chaos settings delay and fail requests on purpose, for testing clients only
+	chaosRate      float64
+	chaosDelay     time.Duration
+	chaosErrorRate float64
+
+	// notFoundTemplate and errorTemplate render 404 and 500 pages, error.html by default
+	notFoundTemplate string
+	errorTemplate    string
+
+	// adminToken guards the admin routes, which are disabled when it is empty
+	adminToken string
+
+	// compactKeepRevisions is how many revisions per note compaction keeps by default
+	compactKeepRevisions int
+	// purgeAge is how long expired notes are kept before they are removed
+	purgeAge time.Duration
+
+	// maxConcurrent bounds in-flight requests; past it they wait concurrencyTimeout, then 503
+	maxConcurrent      int
+	concurrencyTimeout time.Duration
+
+	// maxEventSubscribers caps concurrent /events streams, 0 for no cap
+	maxEventSubscribers int
+	// eventPreviews adds each note's title and a snippet to its /events events
+	eventPreviews bool
+
+	// logSampleEvery logs one in that many successful requests, 1 or less logs them all;
+	// requests slower than logSlow are always logged
+	logSampleEvery int
+	logSlow        time.Duration
+	logSampled     atomic.Uint64
+
+	// gzipLevel compresses responses of at least gzipMinSize bytes, gzip.NoCompression
+	// turns compression off
+	gzipLevel   int
+	gzipMinSize int
+
+	// devMode turns on tools for working on the server itself, see WithDevMode
+	devMode bool
+
+	// createCooldown is how long a session waits between creating notes, 0 for no wait
+	createCooldown time.Duration
+
+	// idleTimeout stops the server after that long without requests, 0 never does
+	idleTimeout time.Duration
+	activity    activity
+
+	// backupDir gets a JSON backup of every note each backupInterval, 0 for no backups
+	backupDir      string
+	backupInterval time.Duration
+	backupKeep     int
+	// backupPassphrase encrypts note content in backups when set, and titles too with
+	// backupEncryptTitles
+	backupPassphrase    string
+	backupEncryptTitles bool
+
+	// drainedAt is when the server started draining, in unix nanoseconds, 0 if it isn't
+	drainedAt  atomic.Int64
+	drainDelay time.Duration
+
+	srv      *http.Server
+	stopping atomic.Bool
+	quit     chan struct{}
+	stopOnce sync.Once
+	stopErr  error
 }
 
-type ApiError struct {
+type ServerOption func(*ApiServer)
+
+// baseTemplateData is the data every page needs. Each page's data struct embeds it.
+type baseTemplateData struct {
+	Banner    string
+	SiteTitle string
+	Favicon   string
+}
+
+type IndexPage struct {
+	baseTemplateData
+	Notes []Note
+}
+
+type ListPage struct {
+	baseTemplateData
+	Notes []ListItem
+
+	// Starred holds the ids of the notes the visitor's session has starred
+	Starred map[string]bool
+
+	// NextURL links to the next page of a paged list, empty on the last page
+	NextURL string
+
+	// IsEmpty is set when there are no notes at all, as opposed to none matching, and the
+	// page shows EmptyMessage with a link to create one
+	IsEmpty      bool
+	EmptyMessage string
+}
+
+type ViewPage struct {
+	baseTemplateData
+	Note Note
+
+	// Description is a short plain text summary of the content for link previews
+	Description string
+
+	// ShowLines renders the content as numbered Lines instead of a single paragraph
+	ShowLines bool
+	Lines     []NumberedLine
+
+	// TrustedContent is the unescaped content of a trusted note, empty otherwise
+	TrustedContent template.HTML
+
+	Views int
+
+	// LinkedContent is the escaped content with [[note-id]] references turned into links
+	LinkedContent template.HTML
+}
+
+type NumberedLine struct {
+	Number int
+	Text   string
+}
+
+type EditPage struct {
+	baseTemplateData
+	MaxContentLength int
+}
+
+type ErrorPage struct {
+	baseTemplateData
 	Error string
 }
+
+type ApiError struct {
+	Error string `json:"error"`
+}
 type TemplComponentFunc func(name string) templ.Component
 
 // utils
 // -----
-func WriteHTML(w http.ResponseWriter, status int, tmpl *template.Template, tmplName string, data any) error {
+// WriteBytes writes a complete response. Every write helper goes through it, so the
+// headers are always set before the status line and browsers never sniff the body for a
+// different type than the one declared.
+func WriteBytes(w http.ResponseWriter, status int, contentType string, body []byte) error {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
 	w.WriteHeader(status)
-	w.Header().Set("Content-Type", "text/html")
 
-	return tmpl.ExecuteTemplate(w, tmplName, data)
+	_, err := w.Write(body)
+	return err
+}
+
+// WriteHTML renders the page tmplName inside the base.html layout. The page is rendered
+// into memory first, so a template error can still be answered with an error page.
+func WriteHTML(w http.ResponseWriter, status int, tmpls map[string]*template.Template, tmplName string, data any) error {
+	tmpl, ok := tmpls[tmplName]
+	if !ok {
+		return fmt.Errorf("unknown template: %s", tmplName)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "base.html", data); err != nil {
+		return err
+	}
+
+	return WriteBytes(w, status, "text/html", buf.Bytes())
+}
+
+// parseTemplates parses each page together with the base.html layout. Pages fill in the
+// layout's "title", "head" and "content" blocks, so each needs its own template set.
+func parseTemplates(pages ...string) map[string]*template.Template {
+	tmpls, err := parseTemplateFiles(pages...)
+	if err != nil {
+		panic(err)
+	}
+	return tmpls
+}
+
+// parseTemplateFiles is parseTemplates for templates that may be broken, like ones being
+// edited while the server runs.
+func parseTemplateFiles(pages ...string) (map[string]*template.Template, error) {
+	tmpls := make(map[string]*template.Template, len(pages))
+	for _, page := range pages {
+		tmpl, err := template.ParseFiles("base.html", page)
+		if err != nil {
+			return nil, err
+		}
+		tmpls[page] = tmpl
+	}
+	return tmpls, nil
 }
 
 func WriteHTML2(r *http.Request, w http.ResponseWriter, status int, component templ.Component) error {
-	w.WriteHeader(status)
-	w.Header().Set("Content-Type", "text/html")
+	var buf bytes.Buffer
+	if err := component.Render(r.Context(), &buf); err != nil {
+		return err
+	}
+
+	return WriteBytes(w, status, "text/html", buf.Bytes())
+}
+
+// WriteJSON writes data as compact JSON, or indented JSON when the request asks for ?pretty=true.
+func WriteJSON(r *http.Request, w http.ResponseWriter, status int, data any) error {
+	var body []byte
+	var err error
+	if r.URL.Query().Get("pretty") == "true" {
+		body, err = json.MarshalIndent(data, "", "  ")
+	} else {
+		body, err = json.Marshal(data)
+	}
+	if err != nil {
+		return err
+	}
+
+	return WriteBytes(w, status, "application/json", append(body, '\n'))
+}
+
+func (s *ApiServer) generateID() string {
+	// the clock can hand out the same nanosecond twice when IDs are made in a loop, so
+	// each ID is bumped past the last one if it has to be
+	for {
+		last := s.lastID.Load()
+		id := max(time.Now().UnixNano(), last+1)
+		if s.lastID.CompareAndSwap(last, id) {
+			return fmt.Sprintf("%s%d", s.idPrefix, id)
+		}
+	}
+}
+
+// WithIDPrefix starts every new note ID with prefix, e.g. "svc1-", so IDs from several
+// instances can be told apart.
+func WithIDPrefix(prefix string) ServerOption {
+	return func(s *ApiServer) {
+		s.idPrefix = prefix
+	}
+}
+
+var (
+	// idPrefixPattern matches the prefixes WithIDPrefix accepts: short and safe in a path.
+	idPrefixPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{0,32}$`)
+
+	// idPattern matches the ids generateID hands out, with any instance's prefix, so notes
+	// exported from another instance keep working here.
+	idPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{0,32}[0-9]{1,20}$`)
+)
 
-	return component.Render(r.Context(), w)
+// isValidID reports whether id could have come from generateID. Anything else (including
+// path-traversal-looking ids) can't name a note, so handlers reject it without touching the store.
+func isValidID(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+// validateNote checks the user supplied fields of a note before it is stored. It checks
+// them all, and returns every problem it finds as ValidationErrors.
+func (s *ApiServer) validateNote(note Note) error {
+	var errs ValidationErrors
+	if strings.TrimSpace(note.Title) == "" {
+		errs = append(errs, ValidationError{Field: "title", Message: "title is required"})
+	}
+	if n := utf8.RuneCountInString(note.Content); n > s.maxContentLength {
+		errs = append(errs, ValidationError{
+			Field:   "content",
+			Message: fmt.Sprintf("content is too long: %d characters, the limit is %d", n, s.maxContentLength),
+		})
+	}
+	errs = append(errs, s.tagErrors(note.Tags)...)
+	if note.CSSClass != "" && (len(note.CSSClass) > maxCSSClassLength || !cssClassPattern.MatchString(note.CSSClass)) {
+		errs = append(errs, ValidationError{
+			Field:   "css_class",
+			Message: fmt.Sprintf("css class must be a letter followed by letters, digits and dashes, at most %d characters", maxCSSClassLength),
+		})
+	}
+	return errs.err()
+}
+
+// cssClassPattern is what a note's CSS class may look like. It is stricter than CSS, so a
+// class can't break out of the class attribute or name more than one class.
+var cssClassPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*$`)
+
+const maxCSSClassLength = 64
+
+var (
+	tagPattern        = regexp.MustCompile(`<[^>]*>`)
+	whitespacePattern = regexp.MustCompile(`\s+`)
+)
+
+// snippet returns content as a single line of plain text, stripped of any HTML tags and
+// cut to at most n characters. The result still needs escaping when rendered.
+func snippet(content string, n int) string {
+	text := tagPattern.ReplaceAllString(content, " ")
+	text = strings.TrimSpace(whitespacePattern.ReplaceAllString(text, " "))
+
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return strings.TrimSpace(string(runes[:n-1])) + "…"
+}
+
+var errUnsupportedMediaType = errors.New("unsupported content type, use a form or application/json")
+
+// maxNoteBody is the largest body a note may be sent in: its content at the longest,
+// every character percent-encoded at its widest, with room for the other fields.
+func (s *ApiServer) maxNoteBody() int64 {
+	return int64(s.maxContentLength)*utf8.UTFMax*3 + 64<<10
+}
+
+// decodeStatus is the status for a note decodeNote couldn't read.
+func decodeStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, errUnsupportedMediaType):
+		return http.StatusUnsupportedMediaType
+	case errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// WithMaxFormFields caps how many values, query parameters included, a form may have.
+// Past it the request is rejected with a 400. Zero or less means no cap.
+func WithMaxFormFields(n int) ServerOption {
+	return func(s *ApiServer) {
+		s.maxFormFields = n
+	}
+}
+
+// parseForm parses r's query and its url encoded or multipart body, and rejects forms
+// with more than the maximum number of values, so a request can't make a handler wade
+// through an arbitrary number of repeated or junk fields. Uploaded files count too.
+func (s *ApiServer) parseForm(r *http.Request) error {
+	// ParseMultipartForm drops the error of a url encoded body it can't parse
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	if err := r.ParseMultipartForm(maxMultipartMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return err
+	}
+
+	count := 0
+	for _, values := range r.Form {
+		count += len(values)
+	}
+	if r.MultipartForm != nil {
+		for _, files := range r.MultipartForm.File {
+			count += len(files)
+		}
+	}
+	if s.maxFormFields > 0 && count > s.maxFormFields {
+		return fmt.Errorf("too many form fields: %d, the limit is %d", count, s.maxFormFields)
+	}
+	return nil
+}
+
+// maxMultipartMemory is how much of a multipart form is kept in memory, the rest goes to temp files.
+const maxMultipartMemory = 10 << 20
+
+// decodeNote reads the user supplied fields of a note from a form or JSON request body.
+// The ttl field, if present, sets ExpiresAt relative to now. Any other content type
+// returns errUnsupportedMediaType. With trimContent set, the title and content lose their
+// leading and trailing whitespace.
+func (s *ApiServer) decodeNote(r *http.Request) (Note, error) {
+	var input struct {
+		Title      string   `json:"title"`
+		Content    string   `json:"content"`
+		TTL        string   `json:"ttl"`
+		Tags       []string `json:"tags"`
+		IsTemplate bool     `json:"is_template"`
+		CSSClass   string   `json:"css_class"`
+	}
+
+	r.Body = http.MaxBytesReader(nil, r.Body, s.maxNoteBody())
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+		if err := s.parseForm(r); err != nil {
+			return Note{}, err
+		}
+		input.Title, input.Content, input.TTL = r.PostFormValue("title"), r.PostFormValue("content"), r.PostFormValue("ttl")
+		input.Tags = parseTags(r.PostFormValue("tags"))
+		input.IsTemplate = r.PostFormValue("is_template") != ""
+		input.CSSClass = r.PostFormValue("css_class")
+	case "application/json":
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			return Note{}, fmt.Errorf("invalid json: %w", err)
+		}
+	default:
+		return Note{}, errUnsupportedMediaType
+	}
+
+	note := Note{
+		Title:      sanitizeContent(input.Title),
+		Content:    sanitizeContent(input.Content),
+		Created:    time.Now(),
+		Tags:       cleanTags(input.Tags),
+		IsTemplate: input.IsTemplate,
+		CSSClass:   strings.TrimSpace(input.CSSClass),
+	}
+	if s.trimContent {
+		note.Title = strings.TrimSpace(note.Title)
+		note.Content = strings.TrimSpace(note.Content)
+	}
+	if input.TTL != "" {
+		expiresAt, err := parseTTL(note.Created, input.TTL)
+		if err != nil {
+			return Note{}, err
+		}
+		note.ExpiresAt = &expiresAt
+	}
+
+	return note, nil
+}
+
+// sanitizeContent replaces invalid UTF-8 with U+FFFD and strips control characters other
+// than newlines and tabs, so stored notes are always safe to encode as JSON or HTML.
+func sanitizeContent(s string) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t' {
+			return -1
+		}
+		return r
+	}, s)
 }
 
 func extractID(path string) string {
@@ -57,7 +588,78 @@ func extractID(path string) string {
 	return ""
 }
 
-func makeHTMLHandlerFunc(fn ApiFunc) http.HandlerFunc {
+// extractAction returns the sub-resource of a note path, e.g. "lock" for /notes/{id}/lock.
+func extractAction(path string) string {
+	parts := strings.Split(path, "/")
+	if len(parts) > 3 {
+		return parts[3]
+	}
+	return ""
+}
+
+// wantsJSON reports whether the client asked for a JSON response. An Accept naming
+// application/json gets JSON and one naming text/html gets HTML. An ambiguous one, */* or
+// none at all, gets the server's default representation. Anything else gets HTML.
+func wantsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "application/json"):
+		return true
+	case strings.Contains(accept, "text/html"):
+		return false
+	case accept == "" || strings.Contains(accept, "*/*"):
+		return r.Context().Value(jsonByDefaultKey{}) == true
+	}
+	return false
+}
+
+// methodNotAllowed answers a request whose method the route doesn't support with a 405
+// and an Allow header. It logs a warning too, since it usually means a misbehaving client.
+// OPTIONS is always allowed and answered with a 204 carrying the same Allow header.
+func (s *ApiServer) methodNotAllowed(w http.ResponseWriter, r *http.Request, allowed ...string) error {
+	allowed = append(allowed, "OPTIONS")
+
+	// every route funnels the methods it doesn't handle through here, so a bare OPTIONS
+	// lands here too and gets the route's method set without a 405
+	if r.Method == "OPTIONS" {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	log.Printf("WARN method not allowed: %s %s from %s (allowed: %s)", r.Method, r.URL.Path, s.clientIP(r), strings.Join(allowed, ", "))
+
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	message := fmt.Sprintf("Method %s not allowed", r.Method)
+	if wantsJSON(r) {
+		return WriteJSON(r, w, http.StatusMethodNotAllowed, ApiError{Error: message})
+	}
+	return WriteHTML(w, http.StatusMethodNotAllowed, templates, "error.html", s.errorPage(message))
+}
+
+// writeFallbackError is the response of last resort when even the error page can't be rendered.
+func writeFallbackError(w http.ResponseWriter, r *http.Request) {
+	if wantsJSON(r) {
+		WriteBytes(w, http.StatusInternalServerError, "application/json", []byte(`{"error":"Internal Server Error"}`+"\n"))
+		return
+	}
+
+	http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+}
+
+func (s *ApiServer) baseData() baseTemplateData {
+	return baseTemplateData{
+		Banner:    s.banner,
+		SiteTitle: s.siteTitle,
+		Favicon:   s.favicon,
+	}
+}
+
+func (s *ApiServer) errorPage(message string) ErrorPage {
+	return ErrorPage{baseTemplateData: s.baseData(), Error: message}
+}
+
+func (s *ApiServer) makeHTMLHandlerFunc(fn ApiFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		err := fn(w, r)
 		if err != nil {
@@ -67,39 +669,322 @@ func makeHTMLHandlerFunc(fn ApiFunc) http.HandlerFunc {
 			// this is here as a last resort
 			// this way, when you want to throw a 500 error, you can just return an error from the handler
 			//  another idea is to have the handler return a status code with the error, but that is not as clean and I THINK that its better to just let the handler function return its own error and success responses
-			err = WriteHTML(w, http.StatusInternalServerError, templates, "error.html", ApiError{Error: err.Error()})
+			err = WriteHTML(w, http.StatusInternalServerError, templates, s.errorTemplate, s.errorPage(err.Error()))
 
-			// if WriteHtml fails, fall back to plain text
+			// if WriteHtml fails, fall back to JSON for API clients and plain text for everyone else
 			if err != nil {
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				writeFallbackError(w, r)
 			}
 		}
 	}
 }
 
-func NewHTMLServer(listAddr string) *ApiServer {
-	return &ApiServer{listAddr: listAddr}
+func NewHTMLServer(listAddr string, opts ...ServerOption) *ApiServer {
+	s := &ApiServer{
+		listAddr:      listAddr,
+		sweepInterval: time.Minute,
+		lockTimeout:   5 * time.Minute,
+		draftTimeout:  24 * time.Hour,
+
+		siteTitle:        "Notes",
+		emptyListMessage: "No notes yet.",
+		shutdownTimeout:  10 * time.Second,
+		maxHeaderBytes:   http.DefaultMaxHeaderBytes,
+		maxContentLength: 50000,
+		maxTags:          10,
+		maxTagLength:     50,
+
+		listTitleLength:   80,
+		listContentLength: 100,
+
+		notFoundTemplate: "error.html",
+		errorTemplate:    "error.html",
+
+		webhookQuietLoc: time.Local,
+
+		compactKeepRevisions: 20,
+		maxEventSubscribers:  100,
+		maxFormFields:        100,
+		countViews:           true,
+		defaultSort:          "created_desc",
+
+		defaultRepresentation: "html",
+		searchSort:            "relevance",
+
+		gzipLevel:   gzip.DefaultCompression,
+		gzipMinSize: 1024,
+
+		durationBuckets: defaultDurationBuckets,
+		sizeBuckets:     defaultSizeBuckets,
+
+		quit: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if !idPrefixPattern.MatchString(s.idPrefix) {
+		log.Fatalf("invalid id prefix %q: use up to 32 letters, digits, '-' or '_'", s.idPrefix)
+	}
+	for tag := range s.allowedTags {
+		if !inlineTags[tag] {
+			log.Fatalf("tag %q can't be allowed in note content, only inline formatting tags can", tag)
+		}
+	}
+	if noteSorts[s.defaultSort] == nil {
+		log.Fatalf("unknown default sort %q", s.defaultSort)
+	}
+	if !searchSorts[s.searchSort] {
+		log.Fatalf("unknown search sort %q: use relevance or recent", s.searchSort)
+	}
+	if !representations[s.defaultRepresentation] {
+		log.Fatalf("unknown default representation %q: use html or json", s.defaultRepresentation)
+	}
+	if s.gzipLevel < gzip.HuffmanOnly || s.gzipLevel > gzip.BestCompression {
+		log.Fatalf("invalid gzip level %d: use %d to %d", s.gzipLevel, gzip.HuffmanOnly, gzip.BestCompression)
+	}
+	if s.gzipMinSize < 0 {
+		log.Fatalf("invalid gzip minimum size %d: it can't be negative", s.gzipMinSize)
+	}
+	if s.sweepInterval <= 0 {
+		log.Fatalf("invalid sweep interval %s: it must be positive", s.sweepInterval)
+	}
+	s.loadErrorTemplates()
+	s.metrics = newMetrics(s.durationBuckets, s.sizeBuckets)
+	s.srv = &http.Server{Addr: listAddr, MaxHeaderBytes: s.maxHeaderBytes}
+
+	return s
+}
+
+// WithTrimContent trims leading and trailing whitespace from the title and content of
+// submitted notes. Off by default, so notes keep exactly what was typed.
+func WithTrimContent(trim bool) ServerOption {
+	return func(s *ApiServer) {
+		s.trimContent = trim
+	}
+}
+
+// WithMaxTotalNotes caps how many notes the server stores. Zero means no cap.
+func WithMaxTotalNotes(n int) ServerOption {
+	return func(s *ApiServer) {
+		s.maxTotalNotes = n
+	}
+}
+
+// atNoteLimit reports whether a server holding count notes has no room for another.
+func (s *ApiServer) atNoteLimit(count int) bool {
+	return s.maxTotalNotes > 0 && count >= s.maxTotalNotes
+}
+
+func errNoteLimit(limit int) error {
+	return fmt.Errorf("this server is full: it holds at most %d notes, delete some to make room", limit)
+}
+
+// WithMaxContentLength sets the most characters a note's content may have.
+func WithMaxContentLength(n int) ServerOption {
+	return func(s *ApiServer) {
+		s.maxContentLength = n
+	}
 }
 
 func (s *ApiServer) Start() {
-	http.HandleFunc("/", makeHTMLHandlerFunc(s.indexHandler)) // Use makeHTMLHandlerFunc to wrap the notesHandler functio
-	http.HandleFunc("/notes", makeHTMLHandlerFunc(s.notesHandler))
-	http.HandleFunc("/notes/", makeHTMLHandlerFunc(s.noteHandler))
+	if s.devMode {
+		log.Println("WARN dev mode: template previews are served at /_preview/")
+	}
+	s.srv.Handler = s.handler()
+
+	go s.sweepExpiredNotes()
+	if s.idleTimeout > 0 {
+		go s.watchIdle()
+	}
+	if s.backupInterval > 0 {
+		go s.backupNotes()
+	}
 
 	log.Println("listening on", s.listAddr)
-	log.Fatal(http.ListenAndServe(s.listAddr, nil)) // Include log.Fatal for proper error handling
+	// ListenAndServe always returns ErrServerClosed after Stop, which is not a failure
+	if err := s.srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err) // Include log.Fatal for proper error handling
+	}
+}
+
+// handler routes the registered routes through the middleware every request passes.
+func (s *ApiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	for _, route := range s.routes() {
+		mux.HandleFunc(route.Path, s.makeHTMLHandlerFunc(s.allowMethods(route)))
+	}
+	return s.withTracing(mux, s.withDefaultRepresentation(s.withRequestID(s.withLogging(s.withGzip(s.withActivity(s.withChaos(s.withConcurrencyLimit(s.withMethodOverride(mux)))))))))
+}
+
+// Stop stops the background jobs and gracefully shuts down the http server.
+// If in-flight requests have not finished within the shutdown timeout (or before ctx is done),
+// the server is closed forcefully and those requests are dropped.
+// Only the first call shuts down, later ones wait for it and return its result.
+func (s *ApiServer) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		s.stopErr = s.shutdown(ctx)
+	})
+	return s.stopErr
+}
+
+// Stopping is closed once the server starts shutting down, whatever stopped it.
+func (s *ApiServer) Stopping() <-chan struct{} {
+	return s.quit
+}
+
+func (s *ApiServer) shutdown(ctx context.Context) error {
+	s.stopping.Store(true)
+	s.waitDrained(ctx)
+	close(s.quit)
+
+	ctx, cancel := context.WithTimeout(ctx, s.shutdownTimeout)
+	defer cancel()
+
+	err := s.srv.Shutdown(ctx)
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		log.Println("shutdown timed out, dropping in-flight requests")
+		return s.srv.Close()
+	}
+	return err
+}
+
+// WithBanner sets a message shown at the top of the index and list pages.
+func WithBanner(banner string) ServerOption {
+	return func(s *ApiServer) {
+		s.banner = banner
+	}
+}
+
+// WithEmptyListMessage sets the message the list page shows, next to a link to create a
+// note, while there are no notes at all.
+func WithEmptyListMessage(message string) ServerOption {
+	return func(s *ApiServer) {
+		s.emptyListMessage = message
+	}
+}
+
+// WithSiteTitle sets the site name shown in every page's title.
+func WithSiteTitle(title string) ServerOption {
+	return func(s *ApiServer) {
+		s.siteTitle = title
+	}
+}
+
+// WithFavicon sets the url of the favicon linked from every page.
+func WithFavicon(href string) ServerOption {
+	return func(s *ApiServer) {
+		s.favicon = href
+	}
+}
+
+// WithMaxHeaderBytes bounds how large a request's headers may be, 1MB by default. The
+// server answers larger ones with 431 Request Header Fields Too Large before any handler
+// runs.
+func WithMaxHeaderBytes(n int) ServerOption {
+	return func(s *ApiServer) {
+		s.maxHeaderBytes = n
+	}
+}
+
+// WithShutdownTimeout sets how long Stop waits for in-flight requests to finish.
+func WithShutdownTimeout(d time.Duration) ServerOption {
+	return func(s *ApiServer) {
+		s.shutdownTimeout = d
+	}
 }
 
 // main
 // ----
 var (
-	templates = template.Must(template.ParseFiles("index.html", "list.html", "edit.html", "error.html", "view.html"))
+	templates = parseTemplates("index.html", "list.html", "edit.html", "error.html", "view.html", "diff.html", "print.html", "timeline.html", "search.html")
 	notes     = make(map[string]Note)
 	mu        = &sync.Mutex{}
 )
 
+// putNote stores a note, stamped with the time as its Updated, records it as the note's
+// newest revision, indexes its title and references and tells /events subscribers. It
+// returns the note as stored.
+// The caller must hold mu.
+func putNote(note Note) Note {
+	note.Updated = time.Now()
+	eventType := "created"
+	if old, exists := notes[note.ID]; exists {
+		titles.remove(old.Title, old.ID)
+		foldedTitles.remove(old.Title, old.ID)
+		eventType = "updated"
+	}
+	titles.add(note.Title, note.ID)
+	foldedTitles.add(note.Title, note.ID)
+
+	notes[note.ID] = note
+	indexReferences(note)
+	recordRevision(note)
+	invalidateListCache()
+	events.publish(noteChanged(eventType, note))
+	return note
+}
+
+// removeNote deletes a note along with its lock, history, draft, stars, view count, title
+// index entry and the references it makes, and tells /events subscribers.
+// The caller must hold mu.
+func removeNote(id string) {
+	if note, exists := notes[id]; exists {
+		titles.remove(note.Title, id)
+		foldedTitles.remove(note.Title, id)
+		events.publish(NoteEvent{Type: "deleted", ID: id})
+	}
+	delete(notes, id)
+	delete(editLocks, id)
+	delete(noteHistory, id)
+	delete(noteViews, id)
+	unindexReferences(id)
+	clearDraft(id)
+	unstarEverywhere(id)
+	invalidateListCache()
+}
+
 func (s *ApiServer) indexHandler(w http.ResponseWriter, r *http.Request) error {
-	return WriteHTML(w, http.StatusOK, templates, "index.html", nil)
+	// "/" matches every path no other route claims
+	if r.URL.Path != "/" {
+		return s.notFoundPage(w, "Page not found")
+	}
+
+	return WriteHTML(w, http.StatusOK, templates, "index.html", IndexPage{
+		baseTemplateData: s.baseData(),
+		Notes:            recentNotes(5),
+	})
+}
+
+// recentNotes returns up to n of the newest notes, newest first.
+// It keeps a small sorted window instead of sorting the whole store.
+func recentNotes(n int) []Note {
+	now := time.Now()
+	recent := make([]Note, 0, n+1)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, note := range notes {
+		if note.expired(now) || note.IsTemplate {
+			continue
+		}
+		if len(recent) == n && !note.Created.After(recent[n-1].Created) {
+			continue
+		}
+
+		i := sort.Search(len(recent), func(i int) bool {
+			return note.Created.After(recent[i].Created)
+		})
+		recent = append(recent, Note{})
+		copy(recent[i+1:], recent[i:])
+		recent[i] = note
+
+		if len(recent) > n {
+			recent = recent[:n]
+		}
+	}
+
+	return recent
 }
 
 func (s *ApiServer) notesHandler(w http.ResponseWriter, r *http.Request) error {
@@ -107,43 +992,270 @@ func (s *ApiServer) notesHandler(w http.ResponseWriter, r *http.Request) error {
 		return s.listNotes(w, r)
 	}
 
+	if r.Method == "HEAD" {
+		return s.listNotes(headWriter{w}, r)
+	}
+
 	if r.Method == "POST" {
 		return s.createNote(w, r)
 	}
 
-	return fmt.Errorf("unsupported method: %s", r.Method)
+	return s.methodNotAllowed(w, r, "GET", "HEAD", "POST")
 }
 
 func (s *ApiServer) listNotes(w http.ResponseWriter, r *http.Request) error {
+	if r.URL.Query().Get("ids") != "" {
+		return s.notesByID(w, r)
+	}
+
+	filter, err := parseNoteFilter(r)
+	var page pageRequest
+	var paged bool
+	if err == nil {
+		page, paged, err = parsePage(r)
+	}
+	if err != nil {
+		if wantsJSON(r) {
+			return WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: err.Error()})
+		}
+		return WriteHTML(w, http.StatusBadRequest, templates, "error.html", s.errorPage(err.Error()))
+	}
+
+	now := time.Now()
+	sortName := s.listSort(w, r)
+
+	// the default view is served from the cache until the notes change
+	cacheable := cacheableList(r) && sortName == s.defaultSort
+	if cacheable {
+		if body, ok := cachedList(now); ok {
+			return writeHTMLBytes(w, http.StatusOK, body)
+		}
+	}
+
+	var firstExpiry time.Time
 	mu.Lock()
-	defer mu.Unlock()
+	gen := listCacheGen()
+	list := make([]Note, 0, len(notes))
+	live := 0
+	for _, note := range notes {
+		if note.expired(now) || note.IsTemplate {
+			continue
+		}
+		live++
+		if filter.match(note) {
+			list = append(list, note)
+			if note.ExpiresAt != nil && (firstExpiry.IsZero() || note.ExpiresAt.Before(firstExpiry)) {
+				firstExpiry = *note.ExpiresAt
+			}
+		}
+	}
+	// pages need a fixed order for their cursors, so they ignore the chosen sort
+	if paged {
+		sortForPaging(list)
+	} else {
+		noteSorts[sortName](list)
+	}
+	mu.Unlock()
+
+	var nextCursor string
+	if paged {
+		list, nextCursor = page.page(list)
+	}
+
+	if wantsJSON(r) {
+		fields := parseFields(r.URL.Query().Get("fields"))
+		out := make([]any, 0, len(list))
+		for _, note := range list {
+			selected, err := selectFields(note, fields)
+			if err != nil {
+				return err
+			}
+			out = append(out, selected)
+		}
+		if paged {
+			return WriteJSON(r, w, http.StatusOK, NotePage{Notes: out, NextCursor: nextCursor})
+		}
+		return WriteJSON(r, w, http.StatusOK, out)
+	}
 
-	return WriteHTML2(r, w, http.StatusOK, hello("world"))
+	var nextURL string
+	if nextCursor != "" {
+		nextURL = nextPageURL(r, nextCursor)
+	}
+
+	if cacheable {
+		body, err := renderHTML("list.html", ListPage{
+			baseTemplateData: s.baseData(),
+			Notes:            s.listItems(list),
+			IsEmpty:          live == 0,
+			EmptyMessage:     s.emptyListMessage,
+		})
+		if err != nil {
+			return err
+		}
+		storeListCache(gen, body, firstExpiry)
+		return writeHTMLBytes(w, http.StatusOK, body)
+	}
+
+	return WriteHTML(w, http.StatusOK, templates, "list.html", ListPage{
+		baseTemplateData: s.baseData(),
+		Notes:            s.listItems(list),
+		Starred:          starredNotes(readSession(r)),
+		NextURL:          nextURL,
+		IsEmpty:          live == 0,
+		EmptyMessage:     s.emptyListMessage,
+	})
+}
+
+func (s *ApiServer) newNoteHandler(w http.ResponseWriter, r *http.Request) error {
+	return WriteHTML(w, http.StatusOK, templates, "edit.html", EditPage{
+		baseTemplateData: s.baseData(),
+		MaxContentLength: s.maxContentLength,
+	})
 }
 
 func (s *ApiServer) createNote(w http.ResponseWriter, r *http.Request) error {
-	r.ParseForm()
-	id := fmt.Sprintf("%d", time.Now().UnixNano())
-	note := Note{
-		ID:      id,
-		Title:   r.FormValue("title"),
-		Content: r.FormValue("content"),
-		Created: time.Now(),
+	session, wait, err := s.cooldownLeft(w, r)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return s.tooSoon(w, r, wait)
 	}
 
-	notes[id] = note
+	note, err := s.decodeNote(r)
+	// a body that can't be parsed must not turn into a note with empty fields
+	if err != nil {
+		return s.noteError(w, r, decodeStatus(err), err.Error())
+	}
+
+	if from := r.URL.Query().Get("from_template"); from != "" {
+		source, ok := templateNote(from)
+		if !ok {
+			return s.noteError(w, r, http.StatusNotFound, "Template not found")
+		}
+		note = fromTemplate(note, source)
+	}
+
+	id := s.generateID()
+	note.ID = id
+	note.Tags = s.withDefaultTags(note.Tags)
+	if s.autoTitle && strings.TrimSpace(note.Title) == "" {
+		note.Title = titleFromContent(note.Content)
+	}
+
+	if err := s.validateNote(note); err != nil {
+		return s.invalidNote(w, r, err)
+	}
+
+	mu.Lock()
+	if s.atNoteLimit(len(notes)) {
+		mu.Unlock()
+		return s.noteError(w, r, http.StatusInsufficientStorage, errNoteLimit(s.maxTotalNotes).Error())
+	}
+	note = putNote(note)
+	mu.Unlock()
+
+	recordCreate(session)
+	s.notifyCreated(r, note)
+
+	// headers must be set before Redirect writes the status line
+	w.Header().Set("X-Note-ID", id)
 	http.Redirect(w, r, "/", http.StatusFound)
 
-	return WriteHTML(w, http.StatusOK, templates, "view.html", notes)
+	return nil
 }
 
 // note handler
 // ------------
 func (s *ApiServer) noteHandler(w http.ResponseWriter, r *http.Request) error {
+	// every /notes/{id} route (get, update, delete and the sub-resources) starts here
+	if !isValidID(extractID(r.URL.Path)) {
+		return s.notFoundPage(w, "Note not found")
+	}
+
+	switch extractAction(r.URL.Path) {
+	case "":
+	case "lock":
+		if r.Method == "POST" {
+			return s.lockNote(w, r)
+		}
+		return s.methodNotAllowed(w, r, "POST")
+	case "unlock":
+		if r.Method == "POST" {
+			return s.unlockNote(w, r)
+		}
+		return s.methodNotAllowed(w, r, "POST")
+	case "diff":
+		if r.Method == "GET" {
+			return s.diffNote(w, r)
+		}
+		return s.methodNotAllowed(w, r, "GET")
+	case "draft":
+		if r.Method == "GET" {
+			return s.getDraft(w, r)
+		}
+		if r.Method == "PUT" {
+			return s.saveDraft(w, r)
+		}
+		return s.methodNotAllowed(w, r, "GET", "PUT")
+	case "star":
+		if r.Method == "POST" {
+			return s.toggleStar(w, r)
+		}
+		return s.methodNotAllowed(w, r, "POST")
+	case "backlinks":
+		if r.Method == "GET" {
+			return s.backlinksNote(w, r)
+		}
+		return s.methodNotAllowed(w, r, "GET")
+	case "raw":
+		if r.Method == "GET" {
+			return s.rawNote(w, r)
+		}
+		return s.methodNotAllowed(w, r, "GET")
+	case "trust":
+		if r.Method == "POST" {
+			return s.trustNote(w, r)
+		}
+		return s.methodNotAllowed(w, r, "POST")
+	case "protect":
+		if r.Method == "POST" {
+			return s.protectNote(w, r)
+		}
+		return s.methodNotAllowed(w, r, "POST")
+	case "split":
+		if r.Method == "POST" {
+			return s.splitNote(w, r)
+		}
+		return s.methodNotAllowed(w, r, "POST")
+	case "tags":
+		if r.Method == "PUT" {
+			return s.updateTags(w, r)
+		}
+		return s.methodNotAllowed(w, r, "PUT")
+	default:
+		// anything else is the note's slug, /notes/{id}/{slug}
+		if strings.Count(r.URL.Path, "/") > 3 {
+			return s.notFoundPage(w, "Not found")
+		}
+		if r.Method == "GET" {
+			return s.getNote(w, r)
+		}
+		if r.Method == "HEAD" {
+			return s.getNote(headWriter{w}, r)
+		}
+		return s.methodNotAllowed(w, r, "GET", "HEAD")
+	}
+
 	if r.Method == "GET" {
 		return s.getNote(w, r)
 	}
 
+	if r.Method == "HEAD" {
+		return s.getNote(headWriter{w}, r)
+	}
+
 	if r.Method == "PUT" {
 		return s.updateNote(w, r)
 	}
@@ -152,7 +1264,7 @@ func (s *ApiServer) noteHandler(w http.ResponseWriter, r *http.Request) error {
 		return s.deleteNote(w, r)
 	}
 
-	return fmt.Errorf("unsupported method: %s", r.Method)
+	return s.methodNotAllowed(w, r, "GET", "HEAD", "PUT", "DELETE")
 }
 
 func (s *ApiServer) getNote(w http.ResponseWriter, r *http.Request) error {
@@ -161,39 +1273,121 @@ func (s *ApiServer) getNote(w http.ResponseWriter, r *http.Request) error {
 	note, ok := notes[id]
 	mu.Unlock()
 
-	if !ok {
-		return WriteHTML(w, http.StatusNotFound, templates, "error.html", "Note not found")
+	// an expired note is gone even if the sweeper has not removed it yet
+	if !ok || note.expired(time.Now()) {
+		if wantsJSON(r) {
+			return WriteJSON(r, w, http.StatusNotFound, ApiError{Error: "Note not found"})
+		}
+		return s.notFoundPage(w, "Note not found")
+	}
+
+	if redirectToSlug(w, r, note) {
+		return nil
 	}
 
-	return WriteHTML(w, http.StatusOK, templates, "view.html", note)
+	w.Header().Set("ETag", noteETag(note))
+	w.Header().Set("Last-Modified", lastModified(note).UTC().Format(http.TimeFormat))
+
+	if wantsJSON(r) {
+		selected, err := selectFields(note, parseFields(r.URL.Query().Get("fields")))
+		if err != nil {
+			return err
+		}
+		return WriteJSON(r, w, http.StatusOK, selected)
+	}
+
+	// only page views count, API reads of the note don't
+	views := s.countView(r, id)
+
+	showLines := r.URL.Query().Get("lines") == "true"
+	var lines []NumberedLine
+	if showLines {
+		lines = numberLines(note.Content)
+	}
+
+	return WriteHTML(w, http.StatusOK, templates, "view.html", ViewPage{
+		baseTemplateData: s.baseData(),
+		Note:             note,
+		Description:      snippet(note.Content, 160),
+		ShowLines:        showLines,
+		Lines:            lines,
+		TrustedContent:   trustedContent(note),
+		Views:            views,
+		LinkedContent:    linkedContent(note.Content, s.allowedTags),
+	})
+}
+
+// numberLines splits content into lines numbered from 1. Empty content has no lines,
+// and a trailing newline doesn't start an extra empty one.
+func numberLines(content string) []NumberedLine {
+	content = strings.TrimSuffix(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	if content == "" {
+		return nil
+	}
+
+	split := strings.Split(content, "\n")
+	lines := make([]NumberedLine, len(split))
+	for i, text := range split {
+		lines[i] = NumberedLine{Number: i + 1, Text: text}
+	}
+	return lines
 }
 
 func (s *ApiServer) updateNote(w http.ResponseWriter, r *http.Request) error {
 	id := extractID(r.URL.Path)
 
-	// Lock the notes map for safe concurrent access
+	// Parse the request body before taking the lock, so a slow client doesn't hold up
+	// every other request
+	input, err := s.decodeNote(r)
+	if err != nil {
+		return s.noteError(w, r, decodeStatus(err), "Error parsing form: "+err.Error())
+	}
+
+	// Lock the notes map for the read-modify-write
 	mu.Lock()
 	defer mu.Unlock()
 
 	// Check if the note exists
 	note, exists := notes[id]
 	if !exists {
-		return WriteHTML(w, http.StatusNotFound, templates, "error.html", ApiError{Error: "Note not found"})
+		return s.noteError(w, r, http.StatusNotFound, "Note not found")
 	}
 
-	// Parse the form data
-	if err := r.ParseForm(); err != nil {
-		return WriteHTML(w, http.StatusInternalServerError, templates, "error.html", ApiError{Error: "Error parsing form"})
+	if note.Locked {
+		return s.noteError(w, r, http.StatusForbidden, errReadOnly)
 	}
 
-	// Update the note with new values
-	notes[id] = Note{
-		ID:      id,
-		Title:   r.FormValue("title"),
-		Content: r.FormValue("content"),
-		Created: note.Created,
+	// A client that read the note can make the update conditional on it being unchanged
+	if !ifMatch(r, noteETag(note)) {
+		return s.noteError(w, r, http.StatusPreconditionFailed, "Note has changed since it was read")
 	}
 
+	// Only the holder of an edit lock may update the note while it is locked
+	if lock, held := s.activeLock(id); held && lock.Token != lockToken(r) {
+		return s.noteError(w, r, http.StatusLocked, "Note is locked by another editor")
+	}
+
+	updated := Note{
+		ID:         id,
+		Title:      input.Title,
+		Content:    input.Content,
+		Created:    note.Created,
+		ExpiresAt:  note.ExpiresAt,
+		Tags:       input.Tags,
+		IsTemplate: note.IsTemplate,
+		Locked:     note.Locked,
+		CSSClass:   input.CSSClass,
+	}
+
+	if err := s.validateNote(updated); err != nil {
+		return s.invalidNote(w, r, err)
+	}
+
+	// Update the note with new values, which commits any autosaved draft
+	updated = putNote(updated)
+	clearDraft(id)
+	w.Header().Set("ETag", noteETag(updated))
+
 	// Redirect to the updated note's view
 	http.Redirect(w, r, "/notes/"+id, http.StatusFound)
 
@@ -205,12 +1399,30 @@ func (s *ApiServer) deleteNote(w http.ResponseWriter, r *http.Request) error {
 
 	mu.Lock()
 	// Check if the note exists before deleting
-	if _, exists := notes[id]; !exists {
+	note, exists := notes[id]
+	if !exists {
 		mu.Unlock() // Unlock before returning
-		return WriteHTML(w, http.StatusNotFound, templates, "error.html", ApiError{Error: "Note not found"})
+		return s.noteError(w, r, http.StatusNotFound, "Note not found")
 	}
 
-	delete(notes, id)
+	if note.Locked {
+		mu.Unlock()
+		return s.noteError(w, r, http.StatusForbidden, errReadOnly)
+	}
+
+	// A client can make the delete conditional on the note not having changed since it
+	// last saw it
+	if !ifUnmodifiedSince(r, lastModified(note)) {
+		mu.Unlock()
+		return s.noteError(w, r, http.StatusPreconditionFailed, "Note has changed since it was read")
+	}
+
+	if isDryRun(r) {
+		mu.Unlock()
+		return writeDryRun(w, r, DryRunPlan{Action: "delete", Count: 1, IDs: []string{id}})
+	}
+
+	removeNote(id)
 	mu.Unlock()
 
 	// Redirect to the main notes listing page after deletion
@@ -220,8 +1432,183 @@ func (s *ApiServer) deleteNote(w http.ResponseWriter, r *http.Request) error {
 }
 
 func main() {
+	sweepInterval := flag.Duration("sweep-interval", time.Minute, "how often expired notes are removed")
+	trustProxy := flag.Bool("trust-proxy", false, "read the client ip from X-Forwarded-For")
+	lockTimeout := flag.Duration("lock-timeout", 5*time.Minute, "how long an edit lock lasts before it expires")
+	draftTimeout := flag.Duration("draft-timeout", 24*time.Hour, "how long an unsaved draft is kept")
+	maxContentLength := flag.Int("max-content-length", 50000, "the most characters a note's content may have")
+	maxTags := flag.Int("max-tags", 10, "the most tags a note may have")
+	maxTagLength := flag.Int("max-tag-length", 50, "the most characters a tag may have")
+	drainDelay := flag.Duration("drain-delay", 0, "on shutdown, how long /readyz answers 503 while requests are still served, before the listener closes")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 10*time.Second, "how long to wait for in-flight requests on shutdown")
+	maxFormFields := flag.Int("max-form-fields", 100, "the most values a form may have, query parameters included, before a 400; 0 for no limit")
+	methodOverride := flag.String("method-override", "", "comma separated methods a POST may be overridden to with _method or X-HTTP-Method-Override, any of PUT, PATCH and DELETE; empty turns overriding off")
+	maxHeaderBytes := flag.Int("max-header-bytes", http.DefaultMaxHeaderBytes, "the most bytes of request headers the server reads before answering 431")
+	siteTitle := flag.String("site-title", "Notes", "the site name shown in every page's title")
+	favicon := flag.String("favicon", "", "url of the favicon linked from every page")
+	gzipLevel := flag.Int("gzip-level", gzip.DefaultCompression, "gzip level for responses, -2 (huffman only) to 9 (best), -1 for the default, 0 to turn compression off")
+	gzipMinSize := flag.Int("gzip-min-size", 1024, "responses smaller than this many bytes are not compressed")
+	dev := flag.Bool("dev", false, "turn on tools for working on the server, like template previews at /_preview/; never use in production")
+	createCooldown := flag.Duration("create-cooldown", 0, "how long a browser session waits between creating notes, 0 for no wait")
+	logSample := flag.Int("log-sample", 1, "log one in this many successful requests, failures and slow requests are always logged")
+	logSlow := flag.Duration("log-slow", time.Second, "requests taking at least this long are always logged, 0 for no threshold")
+	debugBodies := flag.Bool("debug-bodies", false, "log truncated, redacted request bodies (never use in production)")
+	banner := flag.String("banner", os.Getenv("NOTES_BANNER"), "a message shown at the top of the index and list pages (default $NOTES_BANNER)")
+	listTitleLength := flag.Int("list-title-length", 80, "the most characters of a title the list page shows, 0 for all of it")
+	listContentLength := flag.Int("list-content-length", 100, "the most characters of content the list page previews, 0 for none")
+	emptyListMessage := flag.String("empty-list-message", "No notes yet.", "the message the list page shows while there are no notes")
+	notFoundTemplate := flag.String("not-found-template", "error.html", "the page rendered for 404s, parsed with base.html")
+	errorTemplate := flag.String("error-template", "error.html", "the page rendered for 500s, parsed with base.html")
+	adminToken := flag.String("admin-token", os.Getenv("NOTES_ADMIN_TOKEN"), "bearer token for the admin routes, which are disabled without one (default $NOTES_ADMIN_TOKEN)")
+	purgeAge := flag.Duration("purge-age", 0, "how long expired notes are kept in memory before the sweeper or /admin/compact removes them")
+	compactKeepRevisions := flag.Int("compact-keep-revisions", 20, "how many revisions per note /admin/compact keeps")
+	maxConcurrent := flag.Int("max-concurrent", 0, "the most requests handled at once, 0 for no limit")
+	concurrencyTimeout := flag.Duration("concurrency-timeout", 5*time.Second, "how long a request waits for a slot under -max-concurrent before a 503")
+	defaultTags := flag.String("default-tags", "", "comma separated tags given to new notes that have none")
+	alwaysDefaultTags := flag.Bool("always-default-tags", false, "add -default-tags to every new note, even ones with tags")
+	autoTitle := flag.Bool("auto-title", false, "title untitled new notes with the first line of their content")
+	allowedTags := flag.String("allowed-tags", "", "comma separated inline HTML tags kept in note content, e.g. b,i,a,code, the rest is stripped; empty escapes all HTML")
+	normalizeSearch := flag.Bool("search-normalize", false, `make /search and /suggest ignore accents, so "cafe" finds "café"`)
+	searchSort := flag.String("search-sort", "relevance", "the order /search lists results in unless ?sort= picks one: relevance or recent")
+	countViews := flag.Bool("count-views", true, "count page views of each note")
+	chaosDelay := flag.Duration("chaos-delay", 0, "testing only: the longest random delay chaos mode adds to a request, 0 turns chaos mode off")
+	chaosRate := flag.Float64("chaos-rate", 0.1, "testing only: the fraction of requests chaos mode delays")
+	chaosErrorRate := flag.Float64("chaos-error-rate", 0, "testing only: the fraction of delayed requests that fail with a 500")
+	idPrefix := flag.String("id-prefix", "", `a prefix for new note IDs, e.g. "svc1-"`)
+	durationBuckets := flag.String("metrics-duration-buckets", "", "comma separated upper bounds, in seconds, of the response duration histogram")
+	sizeBuckets := flag.String("metrics-size-buckets", "", "comma separated upper bounds, in bytes, of the response size histogram")
+	trimContent := flag.Bool("trim-content", false, "trim leading and trailing whitespace from note titles and content")
+	defaultRepresentation := flag.String("default-representation", "html", "what clients whose Accept header is */* or missing get: html or json")
+	defaultSort := flag.String("default-sort", "created_desc", "the list order for clients that haven't picked one: created_desc, created_asc, title or views_desc")
+	maxTotalNotes := flag.Int("max-notes", 0, "the most notes the server stores, 0 for no limit")
+	tracing := flag.Bool("tracing", false, "trace requests with the global OpenTelemetry tracer provider")
+	createWebhook := flag.String("create-webhook", "", "url every newly created note is POSTed to as JSON")
+	webhookTimeout := flag.Duration("webhook-timeout", 5*time.Second, "how long each -create-webhook attempt may take")
+	webhookSecret := flag.String("webhook-secret", os.Getenv("NOTES_WEBHOOK_SECRET"), "sign -create-webhook bodies with HMAC-SHA256 under this secret, in X-Webhook-Signature-256 (default $NOTES_WEBHOOK_SECRET)")
+	webhookQuietHours := flag.String("webhook-quiet-hours", "", `a window of the day when -create-webhook sends nothing, e.g. "22:00-07:00"`)
+	webhookQuietTZ := flag.String("webhook-quiet-tz", "", "the IANA time zone of -webhook-quiet-hours, the server's by default")
+	fromURL := flag.Bool("from-url", false, "turn on POST /notes/from-url, which fetches a web page server side and saves an excerpt as a note")
+	fromURLTimeout := flag.Duration("from-url-timeout", 10*time.Second, "how long each -from-url fetch may take")
+	fromURLMaxBytes := flag.Int64("from-url-max-bytes", 1<<20, "the most bytes of a page -from-url reads")
+	maxEventSubscribers := flag.Int("max-event-subscribers", 100, "the most clients listening on /events at once, 0 for no limit")
+	eventPreviews := flag.Bool("event-previews", false, "include each changed note's title and a content snippet in /events, not just its id")
+	selfTest := flag.Bool("selftest", false, "create, read, update and delete a test note, then exit: 0 if it all worked, 1 if not")
+	backupDir := flag.String("backup-dir", "backups", "the directory -backup-interval writes backups to")
+	backupInterval := flag.Duration("backup-interval", 0, "how often every note is backed up to -backup-dir as JSON, 0 for never")
+	backupKeep := flag.Int("backup-keep", 10, "how many backups to keep, older ones are deleted, 0 keeps them all")
+	backupPassphrase := flag.String("backup-passphrase", os.Getenv("NOTES_BACKUP_PASSPHRASE"), "encrypt note content and tags in backups with a key derived from this passphrase (default $NOTES_BACKUP_PASSPHRASE)")
+	backupEncryptTitles := flag.Bool("backup-encrypt-titles", false, "with -backup-passphrase, encrypt note titles too")
+	decryptBackupPath := flag.String("decrypt-backup", "", "print the backup at this path decrypted with -backup-passphrase, as JSON /import takes, then exit")
+	idleShutdown := flag.Duration("idle-shutdown", 0, "stop the server after this long without requests, 0 to keep it running")
+	flag.Parse()
+
+	if *decryptBackupPath != "" {
+		if err := decryptBackup(*decryptBackupPath, *backupPassphrase); err != nil {
+			log.Fatal("-decrypt-backup: ", err)
+		}
+		return
+	}
+
+	durations, err := parseBuckets(*durationBuckets)
+	if err != nil {
+		log.Fatal("-metrics-duration-buckets: ", err)
+	}
+	sizes, err := parseBuckets(*sizeBuckets)
+	if err != nil {
+		log.Fatal("-metrics-size-buckets: ", err)
+	}
+
+	overrideMethods, err := parseOverrideMethods(*methodOverride)
+	if err != nil {
+		log.Fatal("-method-override: ", err)
+	}
+
+	quietStart, quietEnd, err := parseQuietHours(*webhookQuietHours)
+	if err != nil {
+		log.Fatal("-webhook-quiet-hours: ", err)
+	}
+	quietLoc := time.Local
+	if *webhookQuietTZ != "" {
+		if quietLoc, err = time.LoadLocation(*webhookQuietTZ); err != nil {
+			log.Fatal("-webhook-quiet-tz: ", err)
+		}
+	}
+
 	fmt.Println("hello creature ...")
 
-	server := NewHTMLServer(":8080")
-	server.Start()
+	server := NewHTMLServer(":8080",
+		WithSweepInterval(*sweepInterval),
+		WithTrustProxy(*trustProxy),
+		WithLockTimeout(*lockTimeout),
+		WithDraftTimeout(*draftTimeout),
+		WithMaxContentLength(*maxContentLength),
+		WithTrimContent(*trimContent),
+		WithMaxTotalNotes(*maxTotalNotes),
+		WithTracerProvider(globalTracerProvider(*tracing)),
+		WithCreateWebhook(*createWebhook, *webhookTimeout),
+		WithWebhookQuietHours(quietStart, quietEnd, quietLoc),
+		WithWebhookSecret(*webhookSecret),
+		WithIdleShutdown(*idleShutdown),
+		WithBackups(*backupDir, *backupInterval, *backupKeep),
+		WithBackupEncryption(*backupPassphrase, *backupEncryptTitles),
+		WithNoteFetch(*fromURL, *fromURLTimeout, *fromURLMaxBytes),
+		WithMaxEventSubscribers(*maxEventSubscribers),
+		WithEventPreviews(*eventPreviews),
+		WithMaxTags(*maxTags),
+		WithMaxTagLength(*maxTagLength),
+		WithDefaultTags(parseTags(*defaultTags), *alwaysDefaultTags),
+		WithAutoTitle(*autoTitle),
+		WithAllowedTags(parseTags(*allowedTags)),
+		WithSearchNormalization(*normalizeSearch),
+		WithSearchSort(*searchSort),
+		WithCountViews(*countViews),
+		WithDefaultSort(*defaultSort),
+		WithDefaultRepresentation(*defaultRepresentation),
+		WithChaos(*chaosRate, *chaosDelay, *chaosErrorRate),
+		WithIDPrefix(*idPrefix),
+		WithMetricsBuckets(durations, sizes),
+		WithShutdownTimeout(*shutdownTimeout),
+		WithDrainDelay(*drainDelay),
+		WithMaxHeaderBytes(*maxHeaderBytes),
+		WithMaxFormFields(*maxFormFields),
+		WithMethodOverride(overrideMethods),
+		WithBanner(*banner),
+		WithEmptyListMessage(*emptyListMessage),
+		WithListPreviewLengths(*listTitleLength, *listContentLength),
+		WithSiteTitle(*siteTitle),
+		WithFavicon(*favicon),
+		WithDebugBodies(*debugBodies),
+		WithLogSampling(*logSample, *logSlow),
+		WithCreateCooldown(*createCooldown),
+		WithDevMode(*dev),
+		WithGzip(*gzipLevel, *gzipMinSize),
+		WithNotFoundTemplate(*notFoundTemplate),
+		WithErrorTemplate(*errorTemplate),
+		WithAdminToken(*adminToken),
+		WithCompactKeepRevisions(*compactKeepRevisions),
+		WithPurgeAge(*purgeAge),
+		WithConcurrencyLimit(*maxConcurrent, *concurrencyTimeout),
+	)
+	if *selfTest {
+		if err := server.SelfTest(store); err != nil {
+			log.Println("selftest FAIL:", err)
+			os.Exit(1)
+		}
+		log.Println("selftest PASS")
+		return
+	}
+
+	go server.Start()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	// an idle shutdown stops the server on its own, Stop then waits for it to finish
+	select {
+	case <-stop:
+	case <-server.Stopping():
+	}
+
+	if err := server.Stop(context.Background()); err != nil {
+		log.Println("shutdown:", err)
+	}
 }
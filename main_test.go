@@ -0,0 +1,500 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer returns a server built with opts and the handler its requests go through,
+// over an empty store. Everything the test stores is forgotten again when it ends.
+func newTestServer(t *testing.T, opts ...ServerOption) (*ApiServer, http.Handler) {
+	t.Helper()
+	resetState()
+	t.Cleanup(resetState)
+	s := NewHTMLServer(":0", opts...)
+	return s, s.handler()
+}
+
+// resetState forgets every note and everything kept about them, and puts back the
+// in-memory store.
+func resetState() {
+	store = memStore{}
+
+	mu.Lock()
+	for id := range notes {
+		removeNote(id)
+	}
+	mu.Unlock()
+
+	draftsMu.Lock()
+	clear(drafts)
+	draftsMu.Unlock()
+	starsMu.Lock()
+	clear(stars)
+	starsMu.Unlock()
+	lastCreatesMu.Lock()
+	clear(lastCreates)
+	lastCreatesMu.Unlock()
+}
+
+// storeTestNote stores note as it is, and returns it as stored.
+func storeTestNote(note Note) Note {
+	mu.Lock()
+	defer mu.Unlock()
+	return putNote(note)
+}
+
+// serve sends a request through h and returns the response. headers are name, value
+// pairs.
+func serve(h http.Handler, method, target, body string, headers ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestWriteJSON(t *testing.T) {
+	data := map[string]any{"id": "1", "tags": []string{"a"}}
+
+	tests := []struct {
+		name   string
+		target string
+		want   string
+	}{
+		{"compact by default", "/notes", `{"id":"1","tags":["a"]}` + "\n"},
+		{"compact unless exactly true", "/notes?pretty=1", `{"id":"1","tags":["a"]}` + "\n"},
+		{"pretty", "/notes?pretty=true", "{\n  \"id\": \"1\",\n  \"tags\": [\n    \"a\"\n  ]\n}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if err := WriteJSON(httptest.NewRequest("GET", tt.target, nil), w, http.StatusCreated, data); err != nil {
+				t.Fatalf("WriteJSON: %v", err)
+			}
+			if w.Code != http.StatusCreated {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusCreated)
+			}
+			if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/json") {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// headerSnapshot records the headers as they were when the status line was written.
+type headerSnapshot struct {
+	*httptest.ResponseRecorder
+	atStatus http.Header
+}
+
+func (h *headerSnapshot) WriteHeader(code int) {
+	if h.atStatus == nil {
+		h.atStatus = h.Header().Clone()
+	}
+	h.ResponseRecorder.WriteHeader(code)
+}
+
+func TestWriteHelperHeaders(t *testing.T) {
+	s := NewHTMLServer(":0")
+	r := httptest.NewRequest("GET", "/", nil)
+	tests := []struct {
+		name        string
+		write       func(w http.ResponseWriter) error
+		contentType string
+	}{
+		{"WriteBytes", func(w http.ResponseWriter) error {
+			return WriteBytes(w, http.StatusTeapot, "text/plain", []byte("body"))
+		}, "text/plain"},
+		{"WriteHTML", func(w http.ResponseWriter) error {
+			return WriteHTML(w, http.StatusTeapot, templates, "error.html", s.errorPage("body"))
+		}, "text/html"},
+		{"WriteHTML2", func(w http.ResponseWriter) error {
+			return WriteHTML2(r, w, http.StatusTeapot, hello("body"))
+		}, "text/html"},
+		{"WriteJSON", func(w http.ResponseWriter) error {
+			return WriteJSON(r, w, http.StatusTeapot, ApiError{Error: "body"})
+		}, "application/json"},
+	}
+	for _, tt := range tests {
+		for _, head := range []bool{false, true} {
+			name := tt.name
+			if head {
+				name += " for HEAD"
+			}
+			t.Run(name, func(t *testing.T) {
+				rec := &headerSnapshot{ResponseRecorder: httptest.NewRecorder()}
+				var w http.ResponseWriter = rec
+				if head {
+					w = headWriter{rec}
+				}
+				if err := tt.write(w); err != nil {
+					t.Fatal(err)
+				}
+
+				if rec.Code != http.StatusTeapot {
+					t.Errorf("status = %d, want %d", rec.Code, http.StatusTeapot)
+				}
+				if rec.atStatus == nil {
+					t.Fatal("the status line was never written")
+				}
+				if got := rec.atStatus.Get("Content-Type"); got != tt.contentType {
+					t.Errorf("Content-Type at the status line = %q, want %q", got, tt.contentType)
+				}
+				if got := rec.atStatus.Get("X-Content-Type-Options"); got != "nosniff" {
+					t.Errorf("X-Content-Type-Options at the status line = %q, want nosniff", got)
+				}
+				if hasBody := rec.Body.Len() > 0; hasBody == head {
+					t.Errorf("body of %d bytes, want one only without HEAD", rec.Body.Len())
+				}
+			})
+		}
+	}
+}
+
+func TestNoteJSON(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	expires := created.Add(time.Hour)
+	tests := []struct {
+		name string
+		note Note
+		want string
+	}{
+		{"every field", Note{
+			ID: "1", Title: "Title", Content: "Content", Created: created, Updated: created, ExpiresAt: &expires,
+			Tags: []string{"a"}, Trusted: true, IsTemplate: true, Locked: true, CSSClass: "wide",
+		}, `{"id":"1","title":"Title","content":"Content","created":"2024-03-01T12:00:00Z","updated":"2024-03-01T12:00:00Z",` +
+			`"expires_at":"2024-03-01T13:00:00Z","tags":["a"],"trusted":true,"is_template":true,"locked":true,"css_class":"wide"}`},
+		{"zero", Note{}, `{"id":"","title":"","content":"","created":"0001-01-01T00:00:00Z","updated":"0001-01-01T00:00:00Z",` +
+			`"expires_at":null,"tags":null,"trusted":false,"is_template":false,"locked":false,"css_class":""}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.note)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("json.Marshal =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStopExpiredDeadline(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []ServerOption
+	}{
+		{"default timeout", nil},
+		{"draining", []ServerOption{WithDrainDelay(time.Hour)}},
+		{"long timeout", []ServerOption{WithShutdownTimeout(time.Hour)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t, tt.opts...)
+
+			// a request that never finishes on its own
+			entered, release := make(chan struct{}), make(chan struct{})
+			defer close(release)
+			s.srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(entered)
+				<-release
+			})
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			go s.srv.Serve(ln)
+
+			requestErr := make(chan error, 1)
+			go func() {
+				resp, err := http.Get("http://" + ln.Addr().String())
+				if err == nil {
+					resp.Body.Close()
+				}
+				requestErr <- err
+			}()
+			<-entered
+
+			ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+			defer cancel()
+			start := time.Now()
+			err = s.Stop(ctx)
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Stop took %s with an expired deadline", elapsed)
+			}
+			if err != nil {
+				t.Errorf("Stop = %v, want the in-flight request dropped without an error", err)
+			}
+			if err := <-requestErr; err == nil {
+				t.Error("the in-flight request finished, want it dropped")
+			}
+
+			select {
+			case <-s.Stopping():
+			default:
+				t.Error("Stopping is still open")
+			}
+			if again := s.Stop(context.Background()); again != err {
+				t.Errorf("second Stop = %v, want the first result %v", again, err)
+			}
+		})
+	}
+}
+
+func TestCreateNoteBadBody(t *testing.T) {
+	// with content of at most 10 characters, a body over 64KiB can't be a note
+	huge := "title=t&content=" + strings.Repeat("a", 70<<10)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"malformed form", "application/x-www-form-urlencoded", "title=ok&content=%zz", http.StatusBadRequest},
+		{"malformed json", "application/json", `{"title": "t", "content": `, http.StatusBadRequest},
+		{"json of the wrong shape", "application/json", `{"title": 1}`, http.StatusBadRequest},
+		{"oversized form", "application/x-www-form-urlencoded", huge, http.StatusRequestEntityTooLarge},
+		{"oversized json", "application/json", `{"title": "t", "content": "` + strings.Repeat("a", 70<<10) + `"}`, http.StatusRequestEntityTooLarge},
+		{"unsupported type", "text/csv", "title,content", http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t, WithMaxContentLength(10))
+			w := serve(h, "POST", "/notes", tt.body, "Content-Type", tt.contentType)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if len(notes) != 0 {
+				t.Errorf("%d notes stored, want none", len(notes))
+			}
+		})
+	}
+}
+
+// lockProbe is a request body that records, when it is first read, whether mu was free.
+type lockProbe struct {
+	io.Reader
+	probed, free bool
+}
+
+func (p *lockProbe) Read(b []byte) (int, error) {
+	if !p.probed {
+		p.probed = true
+		if p.free = mu.TryLock(); p.free {
+			mu.Unlock()
+		}
+	}
+	return p.Reader.Read(b)
+}
+
+func TestUpdateNoteReadsBodyUnlocked(t *testing.T) {
+	_, h := newTestServer(t)
+	storeTestNote(Note{ID: "1", Title: "Old", Content: "x", Created: time.Now()})
+
+	body := &lockProbe{Reader: strings.NewReader("title=New&content=y")}
+	r := httptest.NewRequest("PUT", "/notes/1", body)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusFound || notes["1"].Title != "New" {
+		t.Fatalf("status = %d and title %q, want %d and %q", w.Code, notes["1"].Title, http.StatusFound, "New")
+	}
+	if !body.free {
+		t.Error("the body was read with mu held")
+	}
+}
+
+func TestMaxFormFields(t *testing.T) {
+	// extra repeats a junk field n times
+	extra := func(n int) string { return strings.Repeat("&x=1", n) }
+
+	tests := []struct {
+		name   string
+		max    int
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"under the cap", 5, "POST", "/notes", "title=t&content=c" + extra(2), http.StatusFound},
+		{"at the cap", 5, "POST", "/notes", "title=t&content=c" + extra(3), http.StatusFound},
+		{"over the cap", 5, "POST", "/notes", "title=t&content=c" + extra(4), http.StatusBadRequest},
+		{"query parameters count", 5, "POST", "/notes?a=1&b=2", "title=t&content=c" + extra(2), http.StatusBadRequest},
+		{"way over the default", 100, "POST", "/notes", "title=t&content=c" + extra(1000), http.StatusBadRequest},
+		{"no cap", 0, "POST", "/notes", "title=t&content=c" + extra(1000), http.StatusFound},
+		{"update over the cap", 5, "PUT", "/notes/1", "title=t&content=c" + extra(4), http.StatusBadRequest},
+		{"update under the cap", 5, "PUT", "/notes/1", "title=t&content=c" + extra(3), http.StatusFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t, WithMaxFormFields(tt.max))
+			storeTestNote(Note{ID: "1", Title: "Original", Content: "x", Created: time.Now()})
+
+			w := serve(h, tt.method, tt.target, tt.body, "Content-Type", "application/x-www-form-urlencoded")
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want == http.StatusBadRequest && (len(notes) != 1 || notes["1"].Title != "Original") {
+				t.Error("a rejected form changed the notes")
+			}
+		})
+	}
+}
+
+func TestSanitizeContent(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "hello, world", "hello, world"},
+		{"keeps newlines and tabs", "a\r\n\tb\n", "a\r\n\tb\n"},
+		{"strips NUL", "a\x00b\x00", "ab"},
+		{"strips other controls", "a\x07b\x1bc\x7fd\u0085e", "abcde"},
+		{"replaces invalid UTF-8", "a\xffb", "a�b"},
+		{"one replacement per invalid run", "a\xc3\x28\xff\xfeb", "a�(�b"},
+		{"truncated sequence", "caf\xc3", "caf�"},
+		{"NUL and invalid UTF-8", "\x00\xff\x00", "�"},
+		{"keeps valid multibyte", "café ☕ 日本", "café ☕ 日本"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeContent(tt.in); got != tt.want {
+				t.Errorf("sanitizeContent(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateNoteSanitizes(t *testing.T) {
+	_, h := newTestServer(t)
+	w := serve(h, "POST", "/notes", "title=T%00itle&content=a%00b%FFc", "Content-Type", "application/x-www-form-urlencoded")
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusFound, w.Body)
+	}
+
+	note := notes[w.Header().Get("X-Note-ID")]
+	if note.Title != "Title" || note.Content != "ab�c" {
+		t.Errorf("stored title %q and content %q, want %q and %q", note.Title, note.Content, "Title", "ab�c")
+	}
+}
+
+func TestOptions(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/notes", "GET, HEAD, POST, OPTIONS"},
+		{"/notes/42", "GET, HEAD, PUT, DELETE, OPTIONS"},
+		{"/notes/42/some-slug", "GET, HEAD, OPTIONS"},
+		{"/notes/42/draft", "GET, PUT, OPTIONS"},
+		{"/notes/42/lock", "POST, OPTIONS"},
+		{"/notes/42/tags", "PUT, OPTIONS"},
+		{"/search", "GET, OPTIONS"},
+		{"/import", "POST, OPTIONS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			_, h := newTestServer(t)
+			w := serve(h, "OPTIONS", tt.target, "")
+			if w.Code != http.StatusNoContent {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusNoContent)
+			}
+			if got := w.Header().Get("Allow"); got != tt.want {
+				t.Errorf("Allow = %q, want %q", got, tt.want)
+			}
+			if w.Body.Len() != 0 {
+				t.Errorf("body = %q, want none", w.Body)
+			}
+		})
+	}
+}
+
+func TestCreateNoteTrimContent(t *testing.T) {
+	tests := []struct {
+		name        string
+		trim        bool
+		wantTitle   string
+		wantContent string
+	}{
+		{"off keeps what was typed", false, "  Title ", "\n  content\n\n"},
+		{"on trims", true, "Title", "content"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t, WithTrimContent(tt.trim))
+			w := serve(h, "POST", "/notes", `{"title": "  Title ", "content": "\n  content\n\n"}`, "Content-Type", "application/json")
+			if w.Code != http.StatusFound {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusFound, w.Body)
+			}
+			note := notes[w.Header().Get("X-Note-ID")]
+			if note.Title != tt.wantTitle || note.Content != tt.wantContent {
+				t.Errorf("stored title %q and content %q, want %q and %q", note.Title, note.Content, tt.wantTitle, tt.wantContent)
+			}
+		})
+	}
+
+	t.Run("whitespace only title is rejected when trimming", func(t *testing.T) {
+		_, h := newTestServer(t, WithTrimContent(true))
+		w := serve(h, "POST", "/notes", `{"title": "   ", "content": "x"}`, "Content-Type", "application/json")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestNoteLimit(t *testing.T) {
+	form := []string{"Content-Type", "application/x-www-form-urlencoded"}
+	tests := []struct {
+		name    string
+		limit   int
+		stored  int
+		method  string
+		target  string
+		body    string
+		headers []string
+		want    int
+		// wantNotes is how many notes there are afterwards
+		wantNotes int
+	}{
+		{"create under the cap", 2, 1, "POST", "/notes", "title=t&content=c", form, http.StatusFound, 2},
+		{"create at the cap", 2, 2, "POST", "/notes", "title=t&content=c", form, http.StatusInsufficientStorage, 2},
+		{"no cap", 0, 2, "POST", "/notes", "title=t&content=c", form, http.StatusFound, 3},
+		{"updating at the cap", 2, 2, "PUT", "/notes/1", "title=t&content=c", form, http.StatusFound, 2},
+		{"import over the cap", 3, 2, "POST", "/import", `[{"title": "a", "content": "a"}, {"title": "b", "content": "b"}]`, nil, http.StatusInsufficientStorage, 2},
+		{"import replacing stays under the cap", 2, 2, "POST", "/import", `[{"id": "1", "title": "a", "content": "a"}]`, nil, http.StatusOK, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t, WithMaxTotalNotes(tt.limit))
+			for i := 1; i <= tt.stored; i++ {
+				storeTestNote(Note{ID: strconv.Itoa(i), Title: "Note", Content: "x"})
+			}
+
+			w := serve(h, tt.method, tt.target, tt.body, tt.headers...)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if len(notes) != tt.wantNotes {
+				t.Errorf("%d notes stored, want %d", len(notes), tt.wantNotes)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mergeSeparator goes between the contents of merged notes.
+const mergeSeparator = "\n\n---\n\n"
+
+type MergeResult struct {
+	// ID is the new note holding the merged content
+	ID string `json:"id"`
+	// Merged are the source notes, in the order their content was joined
+	Merged []string `json:"merged"`
+	// SourcesDeleted is set when the sources were deleted after the merge
+	SourcesDeleted bool `json:"sources_deleted"`
+}
+
+// merge handler
+// -------------
+// mergeHandler joins two or more notes, given in order as a comma separated ids form
+// value, into a new note. The contents are joined with a separator and the tags are
+// combined. The title is the title form value, or the source titles joined. With
+// delete_sources=true the sources are deleted too. It all happens in one transaction.
+func (s *ApiServer) mergeHandler(w http.ResponseWriter, r *http.Request) error {
+	if err := s.parseForm(r); err != nil {
+		return WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: err.Error()})
+	}
+
+	ids := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, id := range strings.Split(r.FormValue("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) < 2 {
+		return WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: "give at least two distinct note ids to merge"})
+	}
+	if len(ids) > maxMultiGetIDs {
+		return WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: fmt.Sprintf("too many ids: %d, the limit is %d", len(ids), maxMultiGetIDs)})
+	}
+
+	deleteSources := false
+	if v := r.FormValue("delete_sources"); v != "" {
+		var err error
+		if deleteSources, err = strconv.ParseBool(v); err != nil {
+			return WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: "delete_sources must be true or false"})
+		}
+	}
+	title := sanitizeContent(strings.TrimSpace(r.FormValue("title")))
+	token := lockToken(r)
+
+	var result MergeResult
+	var status int
+	var message string
+	// invalid is set instead when the new note fails validation, to report it field by field
+	var invalid error
+	fail := func(code int, msg string) error {
+		status, message = code, msg
+		return errRollback
+	}
+
+	err := store.WithTx(func(tx Tx) error {
+		now := time.Now()
+		sources := make([]Note, 0, len(ids))
+		missing := make([]string, 0)
+		for _, id := range ids {
+			note, ok := tx.Get(id)
+			if !ok || note.expired(now) {
+				missing = append(missing, id)
+				continue
+			}
+			sources = append(sources, note)
+		}
+		if len(missing) > 0 {
+			return fail(http.StatusNotFound, "Notes not found: "+strings.Join(missing, ", "))
+		}
+
+		merged := Note{ID: s.generateID(), Title: title, Created: now}
+		titles := make([]string, len(sources))
+		contents := make([]string, len(sources))
+		var tags []string
+		for i, note := range sources {
+			titles[i] = note.Title
+			contents[i] = note.Content
+			tags = append(tags, note.Tags...)
+		}
+		if merged.Title == "" {
+			merged.Title = strings.Join(titles, " + ")
+		}
+		merged.Content = strings.Join(contents, mergeSeparator)
+		merged.Tags = cleanTags(tags)
+
+		if invalid = s.validateNote(merged); invalid != nil {
+			return errRollback
+		}
+
+		tx.Put(merged)
+		if deleteSources {
+			for _, note := range sources {
+				if note.Locked {
+					return fail(http.StatusForbidden, fmt.Sprintf("Note %s is read-only, unlock it first", note.ID))
+				}
+				if lock, held := s.activeLock(note.ID); held && lock.Token != token {
+					return fail(http.StatusLocked, fmt.Sprintf("Note %s is locked by another editor", note.ID))
+				}
+				tx.Delete(note.ID)
+			}
+		}
+		if s.maxTotalNotes > 0 && tx.Count() > s.maxTotalNotes {
+			return fail(http.StatusInsufficientStorage, errNoteLimit(s.maxTotalNotes).Error())
+		}
+
+		result = MergeResult{ID: merged.ID, Merged: ids, SourcesDeleted: deleteSources}
+		return nil
+	})
+	if invalid != nil {
+		return WriteJSON(r, w, http.StatusBadRequest, validationBody(invalid))
+	}
+	if status != 0 {
+		return WriteJSON(r, w, status, ApiError{Error: message})
+	}
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("X-Note-ID", result.ID)
+	return WriteJSON(r, w, http.StatusCreated, result)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// default histogram buckets: response durations in seconds and response sizes in bytes
+var (
+	defaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+	defaultSizeBuckets     = []float64{100, 1000, 10_000, 100_000, 1_000_000}
+)
+
+// types
+// -----
+// histogram counts observations into cumulative upper bounds, Prometheus style.
+type histogram struct {
+	bounds []float64
+	counts []uint64 // counts[i] is how many observations were <= bounds[i]
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	bounds = append([]float64(nil), bounds...)
+	sort.Float64s(bounds)
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// metrics are the request metrics the logging middleware records and /metrics reports.
+type metrics struct {
+	mu        sync.Mutex
+	requests  map[string]uint64 // keyed by method and status code, e.g. "GET 200"
+	durations *histogram
+	sizes     *histogram
+}
+
+func newMetrics(durationBuckets, sizeBuckets []float64) *metrics {
+	return &metrics{
+		requests:  make(map[string]uint64),
+		durations: newHistogram(durationBuckets),
+		sizes:     newHistogram(sizeBuckets),
+	}
+}
+
+// record counts one finished request.
+func (m *metrics) record(method string, status int, duration time.Duration, size int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[method+" "+strconv.Itoa(status)]++
+	m.durations.observe(duration.Seconds())
+	m.sizes.observe(float64(size))
+}
+
+// WithMetricsBuckets sets the upper bounds of the response duration (seconds) and size
+// (bytes) histograms. A nil slice keeps the default.
+func WithMetricsBuckets(durations, sizes []float64) ServerOption {
+	return func(s *ApiServer) {
+		if durations != nil {
+			s.durationBuckets = durations
+		}
+		if sizes != nil {
+			s.sizeBuckets = sizes
+		}
+	}
+}
+
+// parseBuckets reads a comma separated list of histogram bounds.
+func parseBuckets(list string) ([]float64, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var bounds []float64
+	for _, field := range strings.Split(list, ",") {
+		bound, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket %q", field)
+		}
+		bounds = append(bounds, bound)
+	}
+	return bounds, nil
+}
+
+// metrics handler
+// ---------------
+// metricsHandler reports the request metrics in the Prometheus text format.
+func (s *ApiServer) metricsHandler(w http.ResponseWriter, r *http.Request) error {
+	var b strings.Builder
+	m := s.metrics
+
+	m.mu.Lock()
+	b.WriteString("# HELP http_requests_total Requests handled, by method and status code.\n")
+	b.WriteString("# TYPE http_requests_total counter\n")
+	keys := make([]string, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		method, code, _ := strings.Cut(key, " ")
+		fmt.Fprintf(&b, "http_requests_total{method=%q,code=%q} %d\n", method, code, m.requests[key])
+	}
+	writeHistogram(&b, "http_response_duration_seconds", "Time taken to handle a request.", m.durations)
+	writeHistogram(&b, "http_response_size_bytes", "Size of response bodies.", m.sizes)
+	m.mu.Unlock()
+
+	return WriteBytes(w, http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
+
+func writeHistogram(b *strings.Builder, name, help string, h *histogram) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for i, bound := range h.bounds {
+		fmt.Fprintf(b, "%s_bucket{le=%q} %d\n", name, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+	}
+	fmt.Fprintf(b, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(b, "%s_sum %s\n", name, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(b, "%s_count %d\n", name, h.count)
+}
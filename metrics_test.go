@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistogramObserve(t *testing.T) {
+	tests := []struct {
+		name   string
+		bounds []float64
+		values []float64
+		want   []uint64
+	}{
+		{"none", []float64{1, 10}, nil, []uint64{0, 0}},
+		{"cumulative", []float64{1, 10, 100}, []float64{0.5, 5, 50, 500}, []uint64{1, 2, 3}},
+		{"on a bound counts in it", []float64{1, 10}, []float64{1, 10}, []uint64{1, 2}},
+		{"above every bound", []float64{1, 10}, []float64{11, 1000}, []uint64{0, 0}},
+		{"bounds are sorted", []float64{100, 1, 10}, []float64{5}, []uint64{0, 1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHistogram(tt.bounds)
+			sum := 0.0
+			for _, v := range tt.values {
+				h.observe(v)
+				sum += v
+			}
+			if !reflect.DeepEqual(h.counts, tt.want) {
+				t.Errorf("counts = %v, want %v", h.counts, tt.want)
+			}
+			if h.count != uint64(len(tt.values)) || h.sum != sum {
+				t.Errorf("count %d and sum %g, want %d and %g", h.count, h.sum, len(tt.values), sum)
+			}
+		})
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	s, h := newTestServer(t, WithMetricsBuckets([]float64{0.1, 1}, []float64{10, 100}))
+	s.metrics.record("GET", 200, 50*time.Millisecond, 5)
+	s.metrics.record("GET", 200, 500*time.Millisecond, 50)
+	s.metrics.record("POST", 302, 2*time.Second, 500)
+
+	body := serve(h, "GET", "/metrics", "").Body.String()
+	for _, want := range []string{
+		`http_requests_total{method="GET",code="200"} 2`,
+		`http_requests_total{method="POST",code="302"} 1`,
+		`http_response_duration_seconds_bucket{le="0.1"} 1`,
+		`http_response_duration_seconds_bucket{le="1"} 2`,
+		`http_response_duration_seconds_bucket{le="+Inf"} 3`,
+		`http_response_duration_seconds_count 3`,
+		`http_response_size_bytes_bucket{le="10"} 1`,
+		`http_response_size_bytes_bucket{le="100"} 2`,
+		`http_response_size_bytes_bucket{le="+Inf"} 3`,
+		`http_response_size_bytes_sum 555`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("/metrics is missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestParseBuckets(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []float64
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"0.1, 1,10", []float64{0.1, 1, 10}, false},
+		{"1,fast", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			got, err := parseBuckets(tt.list)
+			if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseBuckets(%q) = %v, %v, want %v", tt.list, got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// statusRecorder wraps a ResponseWriter to remember the status code the handler wrote
+// and how many body bytes it wrote.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	n, err := rec.ResponseWriter.Write(b)
+	rec.size += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush an
+// event stream.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// headWriter answers a HEAD request with the headers the GET handler sets, dropping the
+// body. The handlers always write one, and net/http refuses bodies on HEAD responses.
+type headWriter struct {
+	http.ResponseWriter
+}
+
+func (hw headWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// WithDebugBodies makes the logging middleware log a truncated, redacted copy of POST and
+// PUT bodies. It is meant for local debugging only, never turn it on in production.
+func WithDebugBodies(debug bool) ServerOption {
+	return func(s *ApiServer) {
+		s.debugBodies = debug
+	}
+}
+
+// WithLogSampling logs only one in every n requests that succeed, for deployments where
+// logging every request floods the logs. Requests that fail with a 4xx or 5xx, and ones
+// that take slow or longer, are always logged. n of 1 or less logs every request, and
+// zero slow puts no request over the threshold.
+func WithLogSampling(n int, slow time.Duration) ServerOption {
+	return func(s *ApiServer) {
+		s.logSampleEvery = n
+		s.logSlow = slow
+	}
+}
+
+// sampled reports whether a request that took duration and answered status is logged.
+// Successes are counted, so exactly one in every logSampleEvery of them is logged.
+func (s *ApiServer) sampled(status int, duration time.Duration) bool {
+	if s.logSampleEvery <= 1 || status >= 400 || (s.logSlow > 0 && duration >= s.logSlow) {
+		return true
+	}
+	return s.logSampled.Add(1)%uint64(s.logSampleEvery) == 1
+}
+
+// withLogging logs every request with its status, duration and client ip, or a sample of
+// them with WithLogSampling, and records them all in the metrics.
+func (s *ApiServer) withLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		var body string
+		if s.debugBodies && (r.Method == "POST" || r.Method == "PUT") {
+			body = peekBody(r)
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		duration := time.Since(start)
+		s.metrics.record(r.Method, rec.status, duration, rec.size)
+
+		if !s.sampled(rec.status, duration) {
+			return
+		}
+		log.Printf("%s %s %d %s %s %s", r.Method, r.URL.Path, rec.status, duration, s.clientIP(r), requestID(r))
+		if body != "" {
+			log.Printf("  body: %s", body)
+		}
+	})
+}
+
+// WithConcurrencyLimit lets at most n requests run handlers at once. Others wait up to
+// timeout for a slot, then get a 503. Zero or less means no limit.
+func WithConcurrencyLimit(n int, timeout time.Duration) ServerOption {
+	return func(s *ApiServer) {
+		s.maxConcurrent = n
+		s.concurrencyTimeout = timeout
+	}
+}
+
+// withConcurrencyLimit bounds how many requests are in flight, using a buffered channel
+// as a semaphore. Unlike a rate limit it doesn't care how fast requests arrive, only how
+// many are being worked on. Event streams don't count.
+func (s *ApiServer) withConcurrencyLimit(next http.Handler) http.Handler {
+	if s.maxConcurrent <= 0 {
+		return next
+	}
+
+	sem := make(chan struct{}, s.maxConcurrent)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// an event stream would hold its slot for as long as it is open, and /events caps
+		// its subscribers on its own
+		if r.URL.Path == "/events" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		timer := time.NewTimer(s.concurrencyTimeout)
+		defer timer.Stop()
+
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+			next.ServeHTTP(w, r)
+		case <-timer.C:
+			s.serviceUnavailable(w, r)
+		case <-r.Context().Done():
+			// the client gave up waiting, there is nobody to answer
+		}
+	})
+}
+
+// serviceUnavailable tells a client the server is too busy right now.
+func (s *ApiServer) serviceUnavailable(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", "1")
+	message := "Server is busy, try again shortly"
+
+	var err error
+	if wantsJSON(r) {
+		err = WriteJSON(r, w, http.StatusServiceUnavailable, ApiError{Error: message})
+	} else {
+		err = WriteHTML(w, http.StatusServiceUnavailable, templates, "error.html", s.errorPage(message))
+	}
+	if err != nil {
+		log.Println("busy response:", err)
+	}
+}
+
+// maxLoggedBody is how many bytes of a request body debug logging reads.
+const maxLoggedBody = 1024
+
+// secretFieldPattern matches the values of form and JSON fields that must never be logged.
+var secretFieldPattern = regexp.MustCompile(`((?:lock_token|token|password|secret)(?:=|"\s*:\s*"))[^&"]*`)
+
+// peekBody returns the start of the request body for logging, and puts what it read back
+// in front of the rest of the body so the handler still sees all of it.
+func peekBody(r *http.Request) string {
+	prefix, err := io.ReadAll(io.LimitReader(r.Body, maxLoggedBody+1))
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(prefix), r.Body), r.Body}
+	if err != nil {
+		return "(unreadable: " + err.Error() + ")"
+	}
+
+	truncated := len(prefix) > maxLoggedBody
+	if truncated {
+		prefix = prefix[:maxLoggedBody]
+	}
+
+	logged := secretFieldPattern.ReplaceAllString(string(prefix), "${1}[REDACTED]")
+	if truncated {
+		logged += "...(truncated)"
+	}
+	return logged
+}
+
+// readCloser reads from one source but closes another, so a re-assembled body still
+// closes the original.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   int
+		timeout time.Duration
+		path    string
+		// freeAfter is how long the busy request keeps its slot once the other one arrives,
+		// 0 for until that one is answered
+		freeAfter time.Duration
+		want      int
+	}{
+		{"over the limit", 1, 10 * time.Millisecond, "/notes", 0, http.StatusServiceUnavailable},
+		{"room for another", 2, 10 * time.Millisecond, "/notes", 0, http.StatusOK},
+		{"no limit", 0, 10 * time.Millisecond, "/notes", 0, http.StatusOK},
+		{"event streams don't count", 1, 10 * time.Millisecond, "/events", 0, http.StatusOK},
+		{"waits for a slot", 1, 5 * time.Second, "/notes", 10 * time.Millisecond, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewHTMLServer(":0", WithConcurrencyLimit(tt.limit, tt.timeout))
+			entered, release := make(chan struct{}), make(chan struct{})
+			h := s.withConcurrencyLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/busy" {
+					close(entered)
+					<-release
+				}
+			}))
+
+			done := make(chan struct{})
+			go func() {
+				serve(h, "GET", "/busy", "")
+				close(done)
+			}()
+			<-entered
+			if tt.freeAfter > 0 {
+				time.AfterFunc(tt.freeAfter, func() { close(release) })
+			}
+
+			w := serve(h, "GET", tt.path, "", "Accept", "application/json")
+			if tt.freeAfter == 0 {
+				close(release)
+			}
+			<-done
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusServiceUnavailable && w.Header().Get("Retry-After") == "" {
+				t.Error("503 without Retry-After")
+			}
+		})
+	}
+}
+
+func TestHead(t *testing.T) {
+	tests := []struct {
+		target string
+		accept string
+		want   int
+	}{
+		{"/notes", "", http.StatusOK},
+		{"/notes", "application/json", http.StatusOK},
+		{"/notes/1", "", http.StatusOK},
+		{"/notes/1", "application/json", http.StatusOK},
+		{"/notes/1/note", "", http.StatusOK},
+		{"/notes/404", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target+" "+tt.accept, func(t *testing.T) {
+			_, h := newTestServer(t)
+			storeTestNote(Note{ID: "1", Title: "Note", Content: "content"})
+
+			get := serve(h, "GET", tt.target, "", "Accept", tt.accept)
+			head := serve(h, "HEAD", tt.target, "", "Accept", tt.accept)
+			if head.Code != tt.want || get.Code != tt.want {
+				t.Fatalf("HEAD status = %d and GET status = %d, want %d", head.Code, get.Code, tt.want)
+			}
+			if head.Body.Len() != 0 {
+				t.Errorf("HEAD body = %q, want none", head.Body)
+			}
+			if get.Body.Len() == 0 {
+				t.Error("GET has no body")
+			}
+			for _, name := range []string{"Content-Type", "ETag", "Last-Modified"} {
+				if got, want := head.Header().Get(name), get.Header().Get(name); got != want {
+					t.Errorf("HEAD %s = %q, GET has %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDebugBodies(t *testing.T) {
+	long := "title=t&token=abc123&password=hunter2&content=" + strings.Repeat("x", 2*maxLoggedBody)
+	tests := []struct {
+		name   string
+		debug  bool
+		method string
+		body   string
+		// logged must all be in the log, secret none of it
+		logged []string
+		secret []string
+	}{
+		{"long form", true, "POST", long, []string{"token=[REDACTED]", "password=[REDACTED]", "...(truncated)"}, []string{"abc123", "hunter2", strings.Repeat("x", maxLoggedBody)}},
+		{"json", true, "PUT", `{"title": "t", "password": "hunter2", "lock_token": "abc123"}`, []string{`"password": "[REDACTED]"`, `"lock_token": "[REDACTED]"`}, []string{"hunter2", "abc123", "truncated"}},
+		{"off", false, "POST", long, nil, []string{"body:"}},
+		{"not a write", true, "DELETE", long, nil, []string{"body:"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			out := log.Writer()
+			log.SetOutput(&logs)
+			t.Cleanup(func() { log.SetOutput(out) })
+
+			var read string
+			s := NewHTMLServer(":0", WithDebugBodies(tt.debug))
+			h := s.withLogging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				read = string(body)
+			}))
+			serve(h, tt.method, "/notes/1", tt.body)
+
+			if read != tt.body {
+				t.Errorf("handler read %d bytes, want all %d", len(read), len(tt.body))
+			}
+			for _, want := range tt.logged {
+				if !strings.Contains(logs.String(), want) {
+					t.Errorf("log is missing %q:\n%s", want, logs.String())
+				}
+			}
+			for _, secret := range tt.secret {
+				if strings.Contains(logs.String(), secret) {
+					t.Errorf("log contains %q:\n%s", secret, logs.String())
+				}
+			}
+		})
+	}
+}
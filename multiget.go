@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxMultiGetIDs bounds how many notes one ?ids= request can ask for.
+const maxMultiGetIDs = 100
+
+// notesByID answers GET /notes?ids=a,b,c with just those notes as a JSON array, in the
+// order they were asked for. An id that appears more than once is returned once, at its
+// first position. Ids that don't name a live note are left out of the array and listed
+// in the X-Missing-Note-IDs header instead. ?fields= applies as it does to the list.
+func (s *ApiServer) notesByID(w http.ResponseWriter, r *http.Request) error {
+	ids := make([]string, 0)
+	for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > maxMultiGetIDs {
+		return WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: fmt.Sprintf("too many ids: %d, the limit is %d", len(ids), maxMultiGetIDs)})
+	}
+
+	now := time.Now()
+	found := make([]Note, 0, len(ids))
+	missing := make([]string, 0)
+	seen := make(map[string]bool, len(ids))
+
+	mu.Lock()
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if note, exists := notes[id]; exists && !note.expired(now) {
+			found = append(found, note)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	mu.Unlock()
+
+	fields := parseFields(r.URL.Query().Get("fields"))
+	out := make([]any, 0, len(found))
+	for _, note := range found {
+		selected, err := selectFields(note, fields)
+		if err != nil {
+			return err
+		}
+		out = append(out, selected)
+	}
+
+	if len(missing) > 0 {
+		w.Header().Set("X-Missing-Note-IDs", strings.Join(missing, ","))
+	}
+	return WriteJSON(r, w, http.StatusOK, out)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+// representations are the values WithDefaultRepresentation takes.
+var representations = map[string]bool{"html": true, "json": true}
+
+// WithDefaultRepresentation sets what clients get when their Accept header doesn't say:
+// "html", the default, or "json". An Accept of */*, as curl sends, or none at all is
+// ambiguous; one naming application/json or text/html still gets that.
+func WithDefaultRepresentation(name string) ServerOption {
+	return func(s *ApiServer) {
+		s.defaultRepresentation = name
+	}
+}
+
+// jsonByDefaultKey marks a request's context when the server answers ambiguous requests
+// with JSON.
+type jsonByDefaultKey struct{}
+
+// withDefaultRepresentation tells wantsJSON the server's default, through the request's
+// context since wantsJSON is called from places that don't have the server.
+func (s *ApiServer) withDefaultRepresentation(next http.Handler) http.Handler {
+	if s.defaultRepresentation != "json" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), jsonByDefaultKey{}, true)))
+	})
+}
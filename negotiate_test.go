@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultRepresentation(t *testing.T) {
+	browser := "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	tests := []struct {
+		name     string
+		fallback string
+		accept   string
+		want     string
+	}{
+		{"*/* gets html by default", "html", "*/*", "text/html"},
+		{"*/* gets the json default", "json", "*/*", "application/json"},
+		{"no Accept gets the json default", "json", "", "application/json"},
+		{"explicit json", "html", "application/json", "application/json"},
+		{"explicit json with a json default", "json", "application/json", "application/json"},
+		{"explicit html", "json", "text/html", "text/html"},
+		{"a browser gets html", "json", browser, "text/html"},
+		{"something else gets html", "json", "image/png", "text/html"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t, WithDefaultRepresentation(tt.fallback))
+			storeTestNote(Note{ID: "1", Title: "Note", Content: "x", Created: time.Now()})
+
+			var headers []string
+			if tt.accept != "" {
+				headers = []string{"Accept", tt.accept}
+			}
+			w := serve(h, "GET", "/notes", "", headers...)
+			if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.want) {
+				t.Errorf("Content-Type = %q, want %s", got, tt.want)
+			}
+		})
+	}
+}
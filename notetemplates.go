@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+)
+
+// fromTemplate fills in what a new note left blank from a template note: its title,
+// content and tags. The result is a normal note, never a template itself.
+func fromTemplate(note, template Note) Note {
+	if note.Title == "" {
+		note.Title = template.Title
+	}
+	if note.Content == "" {
+		note.Content = template.Content
+	}
+	if len(note.Tags) == 0 {
+		note.Tags = append([]string(nil), template.Tags...)
+	}
+	if note.CSSClass == "" {
+		note.CSSClass = template.CSSClass
+	}
+	note.IsTemplate = false
+	return note
+}
+
+// templateNote returns the live template note with the given id.
+func templateNote(id string) (Note, bool) {
+	mu.Lock()
+	note, exists := notes[id]
+	mu.Unlock()
+
+	return note, exists && note.IsTemplate && !note.expired(time.Now())
+}
+
+// templates handler
+// -----------------
+// noteTemplatesHandler lists the template notes, by title.
+func (s *ApiServer) noteTemplatesHandler(w http.ResponseWriter, r *http.Request) error {
+	now := time.Now()
+
+	mu.Lock()
+	list := make([]Note, 0)
+	for _, note := range notes {
+		if note.IsTemplate && !note.expired(now) {
+			list = append(list, note)
+		}
+	}
+	mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Title < list[j].Title
+	})
+
+	if wantsJSON(r) {
+		return WriteJSON(r, w, http.StatusOK, list)
+	}
+
+	return WriteHTML(w, http.StatusOK, templates, "list.html", ListPage{
+		baseTemplateData: s.baseData(),
+		Notes:            s.listItems(list),
+		Starred:          starredNotes(readSession(r)),
+	})
+}
@@ -0,0 +1,964 @@
+package main
+
+import (
+	"net/http"
+)
+
+// types
+// -----
+// A small subset of the OpenAPI 3 document model, just enough to describe this server.
+type OpenAPISpec struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       OpenAPIInfo         `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components OpenAPIComponents   `json:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type OpenAPIComponents struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// PathItem maps a lower case http method to its operation.
+type PathItem map[string]Operation
+
+type Operation struct {
+	Summary     string              `json:"summary"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref        string             `json:"$ref,omitempty"`
+	Type       string             `json:"type,omitempty"`
+	Format     string             `json:"format,omitempty"`
+	Pattern    string             `json:"pattern,omitempty"`
+	Nullable   bool               `json:"nullable,omitempty"`
+	Enum       []string           `json:"enum,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+}
+
+// utils
+// -----
+func ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func htmlResponse(description string) Response {
+	return Response{
+		Description: description,
+		Content:     map[string]MediaType{"text/html": {Schema: &Schema{Type: "string"}}},
+	}
+}
+
+// errorResponse is an error answered with the error page, or an ApiError for clients that
+// accept JSON.
+func errorResponse(description string) Response {
+	return Response{
+		Description: description,
+		Content: map[string]MediaType{
+			"text/html":        {Schema: &Schema{Type: "string"}},
+			"application/json": {Schema: ref("ApiError")},
+		},
+	}
+}
+
+func jsonResponse(description string, schema *Schema) Response {
+	return Response{
+		Description: description,
+		Content:     map[string]MediaType{"application/json": {Schema: schema}},
+	}
+}
+
+func formBody(properties map[string]*Schema, required ...string) *RequestBody {
+	return &RequestBody{
+		Required: true,
+		Content: map[string]MediaType{
+			"application/x-www-form-urlencoded": {Schema: &Schema{Type: "object", Properties: properties, Required: required}},
+		},
+	}
+}
+
+var noteIDParam = Parameter{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "string"}}
+
+// dryRunParam asks a destructive route for its plan instead of its effect
+var dryRunParam = Parameter{Name: "dry_run", In: "query", Schema: &Schema{Type: "boolean"}}
+
+// the list filters, shared by the list and print views
+var (
+	tagParam  = Parameter{Name: "tag", In: "query", Schema: &Schema{Type: "string"}}
+	fromParam = Parameter{Name: "from", In: "query", Schema: &Schema{Type: "string", Format: "date"}}
+	toParam   = Parameter{Name: "to", In: "query", Schema: &Schema{Type: "string", Format: "date"}}
+)
+
+// fieldsParam limits JSON responses to a comma separated list of note fields
+var fieldsParam = Parameter{Name: "fields", In: "query", Schema: &Schema{Type: "string", Format: "comma-separated"}}
+
+// spec
+// ----
+// openAPISpec describes the routes registered in Start. It is written by hand, so keep it
+// in sync when a route, its parameters or its responses change.
+func (s *ApiServer) openAPISpec() OpenAPISpec {
+	createForm := map[string]*Schema{
+		"title":       {Type: "string"},
+		"content":     {Type: "string"},
+		"ttl":         {Type: "string", Format: "duration"},
+		"tags":        {Type: "string", Format: "comma-separated"},
+		"is_template": {Type: "boolean"},
+		"css_class":   {Type: "string", Pattern: cssClassPattern.String()},
+	}
+	updateForm := map[string]*Schema{
+		"title":      {Type: "string"},
+		"content":    {Type: "string"},
+		"tags":       {Type: "string", Format: "comma-separated"},
+		"css_class":  {Type: "string", Pattern: cssClassPattern.String()},
+		"lock_token": {Type: "string"},
+	}
+	lockToken := Parameter{Name: "X-Lock-Token", In: "header", Schema: &Schema{Type: "string"}}
+	adminAuth := Parameter{Name: "Authorization", In: "header", Required: true, Schema: &Schema{Type: "string", Format: "Bearer <admin token>"}}
+	invalidNote := Response{
+		Description: "The note is invalid, field by field as JSON for clients that accept it",
+		Content: map[string]MediaType{
+			"text/html":        {Schema: &Schema{Type: "string"}},
+			"application/json": {Schema: ref("ValidationErrorResponse")},
+		},
+	}
+	ifMatchParam := Parameter{Name: "If-Match", In: "header", Schema: &Schema{Type: "string"}}
+
+	return OpenAPISpec{
+		OpenAPI: "3.0.3",
+		Info:    OpenAPIInfo{Title: "go-html-server notes", Version: "1.0.0"},
+		Paths: map[string]PathItem{
+			"/notes": {
+				"head": {
+					Summary:   "The headers of the note list, without the body",
+					Responses: map[string]Response{"200": {Description: "The list's headers"}},
+				},
+				"get": {
+					Summary: "List notes, or with ids just those notes as JSON, in the order asked for. Repeated ids are returned once; missing ones are listed in X-Missing-Note-IDs",
+					Parameters: []Parameter{
+						fieldsParam,
+						{Name: "ids", In: "query", Schema: &Schema{Type: "string", Format: "comma-separated"}},
+						{Name: "sort", In: "query", Schema: &Schema{Type: "string", Enum: []string{"created_desc", "created_asc", "title", "views_desc"}}},
+						tagParam, fromParam, toParam,
+						{Name: "limit", In: "query", Schema: &Schema{Type: "integer"}},
+						{Name: "cursor", In: "query", Schema: &Schema{Type: "string"}},
+					},
+					Responses: map[string]Response{
+						"200": {
+							Description: "The list of notes, as JSON when the client accepts application/json. With limit or cursor, one page newest first, as a NotePage in JSON",
+							Content: map[string]MediaType{
+								"text/html":        {Schema: &Schema{Type: "string"}},
+								"application/json": {Schema: &Schema{Type: "array", Items: ref("Note")}},
+							},
+						},
+						"400": jsonResponse("A filter, the limit or the cursor is invalid", ref("ApiError")),
+					},
+				},
+				"post": {
+					Summary:     "Create a note, optionally filling blank fields from a template note",
+					Parameters:  []Parameter{{Name: "from_template", In: "query", Schema: &Schema{Type: "string"}}},
+					RequestBody: formBody(createForm, "title"),
+					Responses: map[string]Response{
+						"302": {Description: "Created, the new id is in the X-Note-ID header"},
+						"400": invalidNote,
+						"404": errorResponse("from_template doesn't name a template"),
+						"413": errorResponse("The body is larger than a note of the longest content could be"),
+						"415": errorResponse("The body is neither a form nor JSON"),
+						"429": errorResponse("The session created a note too recently (with -create-cooldown), Retry-After says how many seconds to wait"),
+						"507": errorResponse("There is no room for the note"),
+					},
+				},
+			},
+			"/notes/new": {
+				"get": {
+					Summary:   "The form for creating a note",
+					Responses: map[string]Response{"200": htmlResponse("The form")},
+				},
+			},
+			"/notes/print": {
+				"get": {
+					Summary:    "Every note, or the filtered ones, on one printable page",
+					Parameters: []Parameter{tagParam, fromParam, toParam},
+					Responses: map[string]Response{
+						"200": htmlResponse("The printable page"),
+						"400": htmlResponse("A date is not YYYY-MM-DD"),
+					},
+				},
+			},
+			"/notes/merge": {
+				"post": {
+					Summary:    "Merge two or more notes, in the order given, into a new note, optionally deleting them",
+					Parameters: []Parameter{lockToken},
+					RequestBody: formBody(map[string]*Schema{
+						"ids":            {Type: "string", Format: "comma-separated"},
+						"title":          {Type: "string"},
+						"delete_sources": {Type: "boolean"},
+					}, "ids"),
+					Responses: map[string]Response{
+						"201": jsonResponse("Merged, the new note's id is also in the X-Note-ID header", ref("MergeResult")),
+						"400": jsonResponse("Fewer than two ids (an ApiError), or the merged note is invalid (a ValidationErrorResponse)", ref("ApiError")),
+						"404": jsonResponse("Some of the notes don't exist, they are named in the error", ref("ApiError")),
+						"423": jsonResponse("With delete_sources, a source is locked by another editor", ref("ApiError")),
+						"507": jsonResponse("There is no room for the merged note", ref("ApiError")),
+					},
+				},
+			},
+			"/notes/from-url": {
+				"post": {
+					Summary: "Clip a web page into a new note: its title, an excerpt of it and a link back to it (needs -from-url)",
+					RequestBody: formBody(map[string]*Schema{
+						"url": {Type: "string", Format: "uri"},
+					}, "url"),
+					Responses: map[string]Response{
+						"201": jsonResponse("Created, the new note's id is also in the X-Note-ID header", ref("Note")),
+						"400": jsonResponse("The url isn't an absolute http or https url (an ApiError), or the note is invalid (a ValidationErrorResponse)", ref("ApiError")),
+						"404": jsonResponse("Creating notes from a url is turned off", ref("ApiError")),
+						"429": jsonResponse("The session created a note too recently (with -create-cooldown), Retry-After says how many seconds to wait", ref("ApiError")),
+						"502": jsonResponse("The page couldn't be fetched, isn't HTML, or is on a private address", ref("ApiError")),
+						"507": jsonResponse("There is no room for the note", ref("ApiError")),
+					},
+				},
+			},
+			"/notes/today": {
+				"get": {
+					Summary:    "The notes created today, in the server's time zone or the one given by tz",
+					Parameters: []Parameter{{Name: "tz", In: "query", Schema: &Schema{Type: "string"}}},
+					Responses: map[string]Response{
+						"200": {
+							Description: "Today's notes, as JSON when the client accepts application/json",
+							Content: map[string]MediaType{
+								"text/html":        {Schema: &Schema{Type: "string"}},
+								"application/json": {Schema: &Schema{Type: "array", Items: ref("Note")}},
+							},
+						},
+						"400": jsonResponse("The time zone is unknown", ref("ApiError")),
+					},
+				},
+			},
+			"/notes/random": {
+				"get": {
+					Summary: "A uniformly random note, never a template or an expired note",
+					Responses: map[string]Response{
+						"200": jsonResponse("The note, for clients that accept application/json", ref("Note")),
+						"302": {Description: "Browsers are redirected to the note's page"},
+						"404": jsonResponse("There are no notes", ref("ApiError")),
+					},
+				},
+			},
+			"/timeline": {
+				"get": {
+					Summary:    "The notes grouped by the day they were created, in the server's time zone or the one given by tz",
+					Parameters: []Parameter{{Name: "tz", In: "query", Schema: &Schema{Type: "string"}}},
+					Responses: map[string]Response{
+						"200": {
+							Description: "The days that have notes, newest first, as JSON when the client accepts application/json",
+							Content: map[string]MediaType{
+								"text/html":        {Schema: &Schema{Type: "string"}},
+								"application/json": {Schema: &Schema{Type: "array", Items: ref("TimelineDay")}},
+							},
+						},
+						"400": jsonResponse("The time zone is unknown", ref("ApiError")),
+					},
+				},
+			},
+			"/events": {
+				"get": {
+					Summary: "A server-sent event stream of note changes. Each event is named created, updated or deleted and carries a NoteEvent",
+					Responses: map[string]Response{
+						"200": {
+							Description: "The event stream, open until the client or the server closes it",
+							Content:     map[string]MediaType{"text/event-stream": {Schema: ref("NoteEvent")}},
+						},
+						"503": htmlResponse("Too many clients are already listening"),
+					},
+				},
+			},
+			"/notes/{id}": {
+				"head": {
+					Summary:    "The headers of a note, including its ETag, without the body",
+					Parameters: []Parameter{noteIDParam},
+					Responses: map[string]Response{
+						"200": {Description: "The note's headers"},
+						"404": {Description: "The note does not exist"},
+					},
+				},
+				"get": {
+					Summary:    "Get a note",
+					Parameters: []Parameter{noteIDParam, fieldsParam},
+					Responses: map[string]Response{
+						"200": {
+							Description: "The note, as JSON when the client accepts application/json",
+							Content: map[string]MediaType{
+								"text/html":        {Schema: &Schema{Type: "string"}},
+								"application/json": {Schema: ref("Note")},
+							},
+						},
+						"404": htmlResponse("The note does not exist"),
+					},
+				},
+				"put": {
+					Summary:     "Update a note",
+					Parameters:  []Parameter{noteIDParam, lockToken, ifMatchParam},
+					RequestBody: formBody(updateForm, "title"),
+					Responses: map[string]Response{
+						"302": {Description: "Updated"},
+						"400": invalidNote,
+						"403": errorResponse("The note is read-only"),
+						"404": errorResponse("The note does not exist"),
+						"412": errorResponse("If-Match did not match the note's current ETag"),
+						"413": errorResponse("The body is larger than a note of the longest content could be"),
+						"415": errorResponse("The body is not JSON or a form"),
+						"423": errorResponse("The note is locked by another editor"),
+					},
+				},
+				"delete": {
+					Summary: "Delete a note",
+					Parameters: []Parameter{
+						noteIDParam, dryRunParam,
+						{Name: "If-Unmodified-Since", In: "header", Schema: &Schema{Type: "string", Format: "http-date"}},
+					},
+					Responses: map[string]Response{
+						"200": jsonResponse("With ?dry_run=true, what would be deleted", ref("DryRunPlan")),
+						"302": {Description: "Deleted"},
+						"403": errorResponse("The note is read-only"),
+						"404": errorResponse("The note does not exist"),
+						"412": errorResponse("The note changed after If-Unmodified-Since, it was not deleted"),
+					},
+				},
+			},
+			"/notes/{id}/tags": {
+				"put": {
+					Summary:    "Replace a note's tags",
+					Parameters: []Parameter{noteIDParam, lockToken},
+					RequestBody: &RequestBody{
+						Required: true,
+						Content: map[string]MediaType{
+							"application/json":                  {Schema: &Schema{Type: "array", Items: &Schema{Type: "string"}}},
+							"application/x-www-form-urlencoded": {Schema: &Schema{Type: "object", Properties: map[string]*Schema{"tags": {Type: "string", Format: "comma-separated"}}}},
+							"text/plain":                        {Schema: &Schema{Type: "string", Format: "comma-separated"}},
+						},
+					},
+					Responses: map[string]Response{
+						"200": jsonResponse("The updated note, for clients that accept JSON", ref("Note")),
+						"302": {Description: "Updated"},
+						"404": errorResponse("The note does not exist"),
+						"400": invalidNote,
+						"415": errorResponse("The body is not JSON, a form or plain text"),
+						"423": errorResponse("The note is locked by another editor"),
+					},
+				},
+			},
+			"/notes/{id}/diff": {
+				"get": {
+					Summary: "A word level diff of the content between two revisions of a note, counting from 1",
+					Parameters: []Parameter{
+						noteIDParam,
+						{Name: "from", In: "query", Required: true, Schema: &Schema{Type: "integer"}},
+						{Name: "to", In: "query", Required: true, Schema: &Schema{Type: "integer"}},
+					},
+					Responses: map[string]Response{
+						"200": htmlResponse("The diff, with additions and deletions marked"),
+						"400": htmlResponse("from or to isn't the number of one of the note's revisions"),
+						"404": htmlResponse("The note does not exist"),
+					},
+				},
+			},
+			"/notes/{id}/draft": {
+				"get": {
+					Summary:    "Get the autosaved draft of a note",
+					Parameters: []Parameter{noteIDParam},
+					Responses: map[string]Response{
+						"200": jsonResponse("The draft", ref("Draft")),
+						"404": jsonResponse("There is no draft", ref("ApiError")),
+					},
+				},
+				"put": {
+					Summary:     "Autosave a draft of a note, separate from the note itself",
+					Parameters:  []Parameter{noteIDParam},
+					RequestBody: formBody(map[string]*Schema{"title": {Type: "string"}, "content": {Type: "string"}}),
+					Responses: map[string]Response{
+						"200": jsonResponse("The saved draft", ref("Draft")),
+						"404": jsonResponse("The note does not exist", ref("ApiError")),
+					},
+				},
+			},
+			"/notes/{id}/{slug}": {
+				"get": {
+					Summary: "Get a note by its pretty URL; a wrong slug redirects to the canonical one",
+					Parameters: []Parameter{
+						noteIDParam,
+						{Name: "slug", In: "path", Required: true, Schema: &Schema{Type: "string"}},
+					},
+					Responses: map[string]Response{
+						"200": htmlResponse("The note"),
+						"301": {Description: "The slug doesn't match the title, see Location"},
+						"404": htmlResponse("The note does not exist"),
+					},
+				},
+			},
+			"/notes/{id}/split": {
+				"post": {
+					Summary:    "Split a note in two at a line, a character offset or after a marker. The note keeps the first part, a new note gets the rest",
+					Parameters: []Parameter{noteIDParam, lockToken},
+					RequestBody: formBody(map[string]*Schema{
+						"line":   {Type: "integer"},
+						"offset": {Type: "integer"},
+						"marker": {Type: "string"},
+					}),
+					Responses: map[string]Response{
+						"201": jsonResponse("Split, the new note's id is also in the X-Note-ID header", ref("SplitResult")),
+						"400": jsonResponse("The split point is missing, ambiguous or out of range (an ApiError), or a part is invalid (a ValidationErrorResponse)", ref("ApiError")),
+						"404": jsonResponse("The note doesn't exist", ref("ApiError")),
+						"423": jsonResponse("The note is locked by another editor", ref("ApiError")),
+						"507": jsonResponse("There is no room for the new note", ref("ApiError")),
+					},
+				},
+			},
+			"/notes/{id}/trust": {
+				"post": {
+					Summary:     "Mark a note's content as trusted HTML, or clear the mark. Trusted content is rendered unescaped, so only trust content you wrote",
+					Parameters:  []Parameter{noteIDParam, adminAuth},
+					RequestBody: formBody(map[string]*Schema{"trusted": {Type: "boolean"}}, "trusted"),
+					Responses: map[string]Response{
+						"200": jsonResponse("The updated note", ref("Note")),
+						"400": jsonResponse("trusted is not a boolean", ref("ApiError")),
+						"401": jsonResponse("The admin token is missing or wrong", ref("ApiError")),
+						"404": jsonResponse("The note does not exist", ref("ApiError")),
+					},
+				},
+			},
+			"/notes/{id}/backlinks": {
+				"get": {
+					Summary:    "The notes whose content references this one with [[id]]",
+					Parameters: []Parameter{noteIDParam},
+					Responses: map[string]Response{
+						"200": {
+							Description: "The referencing notes, as JSON when the client accepts application/json",
+							Content: map[string]MediaType{
+								"text/html":        {Schema: &Schema{Type: "string"}},
+								"application/json": {Schema: &Schema{Type: "array", Items: ref("Note")}},
+							},
+						},
+						"404": htmlResponse("The note does not exist"),
+					},
+				},
+			},
+			"/notes/{id}/raw": {
+				"get": {
+					Summary:    "A note's content alone, as plain text",
+					Parameters: []Parameter{noteIDParam, {Name: "If-None-Match", In: "header", Schema: &Schema{Type: "string"}}},
+					Responses: map[string]Response{
+						"200": {Description: "The content", Content: map[string]MediaType{"text/plain": {Schema: &Schema{Type: "string"}}}},
+						"304": {Description: "If-None-Match matches the note's ETag, the client's copy is current"},
+						"404": {Description: "The note does not exist", Content: map[string]MediaType{"text/plain": {Schema: &Schema{Type: "string"}}}},
+					},
+				},
+			},
+			"/notes/{id}/star": {
+				"post": {
+					Summary:    "Star or unstar a note for the current session",
+					Parameters: []Parameter{noteIDParam},
+					Responses: map[string]Response{
+						"200": jsonResponse("Whether the note is now starred, for clients that accept JSON", ref("StarResponse")),
+						"302": {Description: "Toggled"},
+						"404": htmlResponse("The note does not exist"),
+					},
+				},
+			},
+			"/notes/{id}/lock": {
+				"post": {
+					Summary:    "Take out or renew the edit lock on a note",
+					Parameters: []Parameter{noteIDParam, lockToken},
+					Responses: map[string]Response{
+						"200": jsonResponse("The lock", ref("LockResponse")),
+						"404": jsonResponse("The note does not exist", ref("ApiError")),
+						"423": jsonResponse("The note is locked by another editor", ref("ApiError")),
+					},
+				},
+			},
+			"/notes/{id}/protect": {
+				"post": {
+					Summary:    "Make a note read-only until it is unlocked",
+					Parameters: []Parameter{noteIDParam},
+					Responses: map[string]Response{
+						"200": jsonResponse("The protected note", ref("Note")),
+						"302": {Description: "Protected, redirects to the note for HTML clients"},
+						"404": jsonResponse("The note does not exist", ref("ApiError")),
+					},
+				},
+			},
+			"/notes/{id}/unlock": {
+				"post": {
+					Summary:    "Release the edit lock on a note and make it writable if it is read-only",
+					Parameters: []Parameter{noteIDParam, lockToken},
+					Responses: map[string]Response{
+						"204": {Description: "Unlocked"},
+						"404": jsonResponse("The note does not exist", ref("ApiError")),
+						"423": jsonResponse("The note is locked by another editor", ref("ApiError")),
+					},
+				},
+			},
+			"/templates": {
+				"get": {
+					Summary: "The template notes, which new notes can start from with POST /notes?from_template={id}",
+					Responses: map[string]Response{"200": {
+						Description: "The templates, as JSON when the client accepts application/json",
+						Content: map[string]MediaType{
+							"text/html":        {Schema: &Schema{Type: "string"}},
+							"application/json": {Schema: &Schema{Type: "array", Items: ref("Note")}},
+						},
+					}},
+				},
+			},
+			"/favorites": {
+				"get": {
+					Summary: "The notes the current session has starred",
+					Responses: map[string]Response{"200": {
+						Description: "The starred notes, as JSON when the client accepts application/json",
+						Content: map[string]MediaType{
+							"text/html":        {Schema: &Schema{Type: "string"}},
+							"application/json": {Schema: &Schema{Type: "array", Items: ref("Note")}},
+						},
+					}},
+				},
+			},
+			"/export": {
+				"get": {
+					Summary:   "Download every note, oldest first",
+					Responses: map[string]Response{"200": jsonResponse("All notes", &Schema{Type: "array", Items: ref("Note")})},
+				},
+			},
+			"/export/markdown": {
+				"get": {
+					Summary: "Download every note, oldest first, as one Markdown document",
+					Responses: map[string]Response{
+						"200": {
+							Description: "A ## section per note, with its metadata and its content in a fenced block",
+							Content:     map[string]MediaType{"text/markdown": {Schema: &Schema{Type: "string"}}},
+						},
+					},
+				},
+			},
+			"/_preview/{template}": {
+				"get": {
+					Summary: "Render a page template with sample data, read fresh from disk, for working on its look (needs -dev)",
+					Parameters: []Parameter{{Name: "template", In: "path", Required: true, Schema: &Schema{Type: "string", Enum: []string{
+						"index", "list", "empty-list", "note", "note-lines", "edit", "error", "search", "timeline", "print", "diff",
+					}}}},
+					Responses: map[string]Response{
+						"200": htmlResponse("The page"),
+						"404": htmlResponse("The template is unknown, or the server isn't in dev mode"),
+						"500": htmlResponse("The template doesn't parse"),
+					},
+				},
+			},
+			"/import": {
+				"post": {
+					Summary: "Load notes in the format /export writes, keeping their IDs",
+					RequestBody: &RequestBody{
+						Required: true,
+						Content:  map[string]MediaType{"application/json": {Schema: &Schema{Type: "array", Items: ref("Note")}}},
+					},
+					Responses: map[string]Response{
+						"200": jsonResponse("How many notes were imported", ref("ImportResult")),
+						"400": jsonResponse("The import is invalid or has too many notes, nothing was imported", ref("ApiError")),
+						"403": jsonResponse("The import would replace a read-only note and the caller is not an admin, nothing was imported", ref("ApiError")),
+						"413": jsonResponse("The body is larger than the most notes of the longest content could be", ref("ApiError")),
+						"423": jsonResponse("The import would replace a note someone is editing and the caller is not an admin, nothing was imported", ref("ApiError")),
+						"507": jsonResponse("The notes would go over the note limit, nothing was imported", ref("ApiError")),
+					},
+				},
+			},
+			"/import/markdown": {
+				"post": {
+					Summary: "Create a note from each uploaded .md file, titled with the file name",
+					RequestBody: &RequestBody{
+						Required: true,
+						Content: map[string]MediaType{"multipart/form-data": {Schema: &Schema{
+							Type:       "object",
+							Properties: map[string]*Schema{"files": {Type: "array", Items: &Schema{Type: "string", Format: "binary"}}},
+						}}},
+					},
+					Responses: map[string]Response{
+						"200": jsonResponse("How many notes were imported, with a warning for each skipped file", ref("ImportResult")),
+						"400": jsonResponse("The upload or a file is invalid, or there are more files than -max-form-fields, nothing was imported", ref("ApiError")),
+						"413": jsonResponse("The upload is larger than the most notes of the longest content could be", ref("ApiError")),
+						"507": jsonResponse("The notes would go over the note limit, nothing was imported", ref("ApiError")),
+					},
+				},
+			},
+			"/healthz": {
+				"get": {
+					Summary: "Whether the server is alive and its store answers",
+					Responses: map[string]Response{
+						"200": jsonResponse("Healthy", ref("HealthStatus")),
+						"503": jsonResponse("The store doesn't answer", ref("HealthStatus")),
+					},
+				},
+			},
+			"/readyz": {
+				"get": {
+					Summary: "Whether the server is ready for traffic",
+					Responses: map[string]Response{
+						"200": jsonResponse("Ready", ref("HealthStatus")),
+						"503": jsonResponse("The store doesn't answer, or the server is draining or shutting down", ref("HealthStatus")),
+					},
+				},
+			},
+			"/metrics": {
+				"get": {
+					Summary: "Request counts and response duration and size histograms, in the Prometheus text format",
+					Responses: map[string]Response{"200": {
+						Description: "The metrics",
+						Content:     map[string]MediaType{"text/plain": {Schema: &Schema{Type: "string"}}},
+					}},
+				},
+			},
+			"/version": {
+				"get": {
+					Summary: "The version, commit and build time of the running server, and the Go version it was built with",
+					Responses: map[string]Response{"200": {
+						Description: "The build info, as JSON when the client accepts application/json",
+						Content: map[string]MediaType{
+							"text/plain":       {Schema: &Schema{Type: "string"}},
+							"application/json": {Schema: ref("VersionInfo")},
+						},
+					}},
+				},
+			},
+			"/stats/memory": {
+				"get": {
+					Summary:   "Counts of what the in-memory store is holding",
+					Responses: map[string]Response{"200": jsonResponse("The counts", ref("MemoryStats"))},
+				},
+			},
+			"/admin/compact": {
+				"post": {
+					Summary: "Remove notes that expired at least older_than ago (expiry stands in for soft delete), remove stale drafts and trim note history",
+					Parameters: []Parameter{
+						adminAuth,
+						{Name: "keep", In: "query", Schema: &Schema{Type: "integer"}},
+						{Name: "older_than", In: "query", Schema: &Schema{Type: "string", Format: "duration"}},
+						dryRunParam,
+					},
+					Responses: map[string]Response{
+						"200": jsonResponse("What was removed, or with ?dry_run=true a DryRunPlan", ref("CompactResult")),
+						"400": jsonResponse("keep is not a positive number, or older_than is not a duration", ref("ApiError")),
+						"401": jsonResponse("The admin token is missing or wrong", ref("ApiError")),
+					},
+				},
+			},
+			"/admin/drain": {
+				"get": {
+					Summary:    "Whether the server is draining",
+					Parameters: []Parameter{adminAuth},
+					Responses: map[string]Response{
+						"200": jsonResponse("The drain state", ref("DrainStatus")),
+						"401": jsonResponse("The admin token is missing or wrong", ref("ApiError")),
+					},
+				},
+				"post": {
+					Summary:    "Start draining: /readyz answers 503 while requests are still served, for pre-stop hooks",
+					Parameters: []Parameter{adminAuth},
+					Responses: map[string]Response{
+						"200": jsonResponse("Draining", ref("DrainStatus")),
+						"401": jsonResponse("The admin token is missing or wrong", ref("ApiError")),
+					},
+				},
+				"delete": {
+					Summary:    "Stop draining, so /readyz answers 200 again",
+					Parameters: []Parameter{adminAuth},
+					Responses: map[string]Response{
+						"200": jsonResponse("Ready again", ref("DrainStatus")),
+						"401": jsonResponse("The admin token is missing or wrong", ref("ApiError")),
+						"409": jsonResponse("The server is already shutting down", ref("ApiError")),
+					},
+				},
+			},
+			"/suggest": {
+				"get": {
+					Summary: "Notes whose title starts with a prefix, for autocomplete",
+					Parameters: []Parameter{
+						{Name: "q", In: "query", Schema: &Schema{Type: "string"}},
+						{Name: "limit", In: "query", Schema: &Schema{Type: "integer"}},
+					},
+					Responses: map[string]Response{
+						"200": jsonResponse("The matching notes", &Schema{Type: "array", Items: ref("Suggestion")}),
+					},
+				},
+			},
+			"/search": {
+				"get": {
+					Summary: "Notes whose title or content contains q, ignoring case, best match first or newest first",
+					Parameters: []Parameter{
+						{Name: "q", In: "query", Schema: &Schema{Type: "string"}},
+						{Name: "sort", In: "query", Schema: &Schema{Type: "string", Enum: []string{"relevance", "recent"}}},
+					},
+					Responses: map[string]Response{"200": {
+						Description: "The matches with a highlighted snippet each, as JSON when the client accepts application/json",
+						Content: map[string]MediaType{
+							"text/html":        {Schema: &Schema{Type: "string"}},
+							"application/json": {Schema: &Schema{Type: "array", Items: ref("SearchResult")}},
+						},
+					}},
+				},
+			},
+			"/api/routes": {
+				"get": {
+					Summary: "Every registered route with its methods and what it does",
+					Responses: map[string]Response{
+						"200": jsonResponse("The routes, from the registry the server is built from", &Schema{Type: "array", Items: ref("Route")}),
+					},
+				},
+			},
+			"/api/batch": {
+				"post": {
+					Summary: "Apply several create, update and delete operations in order",
+					Parameters: []Parameter{
+						{Name: "atomic", In: "query", Schema: &Schema{Type: "boolean"}},
+						dryRunParam,
+					},
+					RequestBody: &RequestBody{
+						Required: true,
+						Content:  map[string]MediaType{"application/json": {Schema: &Schema{Type: "array", Items: ref("BatchOp")}}},
+					},
+					Responses: map[string]Response{
+						"200": jsonResponse("One result per operation, or with ?dry_run=true a DryRunPlan", &Schema{Type: "array", Items: ref("BatchResult")}),
+						"400": jsonResponse("The batch is malformed or has too many ops, nothing was applied", ref("ApiError")),
+						"409": jsonResponse("With ?atomic=true, an op failed and nothing was applied", &Schema{Type: "array", Items: ref("BatchResult")}),
+						"413": jsonResponse("The body is larger than the most ops of the longest notes could be", ref("ApiError")),
+					},
+				},
+			},
+		},
+		Components: OpenAPIComponents{
+			Schemas: map[string]*Schema{
+				"Note": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"id":          {Type: "string"},
+						"title":       {Type: "string"},
+						"content":     {Type: "string"},
+						"created":     {Type: "string", Format: "date-time"},
+						"updated":     {Type: "string", Format: "date-time"},
+						"expires_at":  {Type: "string", Format: "date-time", Nullable: true},
+						"tags":        {Type: "array", Items: &Schema{Type: "string"}, Nullable: true},
+						"trusted":     {Type: "boolean"},
+						"is_template": {Type: "boolean"},
+						"locked":      {Type: "boolean"},
+						"css_class":   {Type: "string", Pattern: cssClassPattern.String()},
+					},
+				},
+				"Route": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"path":        {Type: "string"},
+						"methods":     {Type: "array", Items: &Schema{Type: "string"}},
+						"description": {Type: "string"},
+					},
+				},
+				"ApiError": {
+					Type:       "object",
+					Properties: map[string]*Schema{"error": {Type: "string"}},
+				},
+				"ValidationErrorResponse": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"errors": {Type: "array", Items: &Schema{
+							Type: "object",
+							Properties: map[string]*Schema{
+								"field":   {Type: "string", Enum: []string{"title", "content", "tags"}},
+								"message": {Type: "string"},
+							},
+						}},
+					},
+				},
+				"BatchOp": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"op":      {Type: "string", Enum: []string{"create", "update", "delete"}},
+						"id":      {Type: "string"},
+						"title":   {Type: "string"},
+						"content": {Type: "string"},
+					},
+					Required: []string{"op"},
+				},
+				"BatchResult": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"op":     {Type: "string"},
+						"id":     {Type: "string"},
+						"status": {Type: "integer"},
+						"error":  {Type: "string"},
+					},
+				},
+				"Draft": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"title":   {Type: "string"},
+						"content": {Type: "string"},
+						"saved":   {Type: "string", Format: "date-time"},
+					},
+				},
+				"TimelineDay": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"label": {Type: "string"},
+						"date":  {Type: "string", Format: "date-time"},
+						"notes": {Type: "array", Items: ref("Note")},
+					},
+				},
+				"StarResponse": {
+					Type:       "object",
+					Properties: map[string]*Schema{"starred": {Type: "boolean"}},
+				},
+				"Suggestion": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"id":    {Type: "string"},
+						"title": {Type: "string"},
+					},
+				},
+				"MergeResult": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"id":              {Type: "string"},
+						"merged":          {Type: "array", Items: &Schema{Type: "string"}},
+						"sources_deleted": {Type: "boolean"},
+					},
+				},
+				"SplitResult": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"original": {Type: "string"},
+						"new":      {Type: "string"},
+					},
+				},
+				"NotePage": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"notes":       {Type: "array", Items: ref("Note")},
+						"next_cursor": {Type: "string"},
+					},
+				},
+				"NoteEvent": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"type": {Type: "string", Enum: []string{"created", "updated", "deleted"}},
+						"id":   {Type: "string"},
+						// with -event-previews, for creates and updates
+						"title":   {Type: "string"},
+						"snippet": {Type: "string"},
+					},
+					Required: []string{"type", "id"},
+				},
+				"SearchResult": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"note":    ref("Note"),
+						"snippet": {Type: "string", Format: "html"},
+						// 1000 per title occurrence plus one per content occurrence
+						"score": {Type: "integer"},
+					},
+				},
+				"DryRunPlan": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"dry_run": {Type: "boolean"},
+						"action":  {Type: "string"},
+						"count":   {Type: "integer"},
+						"ids":     {Type: "array", Items: &Schema{Type: "string"}},
+						"details": {Type: "object"},
+					},
+				},
+				"DrainStatus": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"draining": {Type: "boolean"},
+						"since":    {Type: "string", Format: "date-time"},
+					},
+				},
+				"HealthStatus": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"status": {Type: "string", Enum: []string{"ok", "unavailable"}},
+						"error":  {Type: "string"},
+					},
+				},
+				"ImportResult": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"imported": {Type: "integer"},
+						"warnings": {Type: "array", Items: &Schema{Type: "string"}},
+					},
+				},
+				"VersionInfo": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"version":    {Type: "string"},
+						"commit":     {Type: "string"},
+						"build_time": {Type: "string"},
+						"go_version": {Type: "string"},
+					},
+				},
+				"MemoryStats": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"notes":         {Type: "integer"},
+						"expired_notes": {Type: "integer"},
+						"drafts":        {Type: "integer"},
+						"revisions":     {Type: "integer"},
+					},
+				},
+				"CompactResult": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"removed_notes":     {Type: "integer"},
+						"removed_drafts":    {Type: "integer"},
+						"trimmed_revisions": {Type: "integer"},
+					},
+				},
+				"LockResponse": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"token":      {Type: "string"},
+						"expires_at": {Type: "string", Format: "date-time"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (s *ApiServer) openAPIHandler(w http.ResponseWriter, r *http.Request) error {
+	return WriteJSON(r, w, http.StatusOK, s.openAPISpec())
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// overridableMethods are the only methods a POST may ever be overridden to. GET and HEAD
+// are left out so an override can't turn a write into a cacheable read, and anything
+// else so it can't reach methods no route expects.
+var overridableMethods = []string{"PUT", "PATCH", "DELETE"}
+
+// WithMethodOverride lets HTML forms, which can only GET and POST, send other methods: a
+// POST with a _method form or query value, or an X-HTTP-Method-Override header, is
+// handled as that method if it is in methods. Overrides to other methods are rejected
+// with a 400, and overrides on anything but a POST are ignored. No methods, the default,
+// turns overriding off.
+func WithMethodOverride(methods []string) ServerOption {
+	return func(s *ApiServer) {
+		s.overrideMethods = make(map[string]bool)
+		for _, method := range methods {
+			s.overrideMethods[strings.ToUpper(method)] = true
+		}
+	}
+}
+
+// parseOverrideMethods reads a comma separated method list for WithMethodOverride,
+// refusing any method that isn't overridable.
+func parseOverrideMethods(list string) ([]string, error) {
+	methods := make([]string, 0)
+	for _, method := range strings.Split(list, ",") {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if method == "" {
+			continue
+		}
+		if !slices.Contains(overridableMethods, method) {
+			return nil, fmt.Errorf("%s can't be overridden to, only %s", method, strings.Join(overridableMethods, ", "))
+		}
+		methods = append(methods, method)
+	}
+	return methods, nil
+}
+
+// withMethodOverride applies method overrides before the request is routed.
+func (s *ApiServer) withMethodOverride(next http.Handler) http.Handler {
+	if len(s.overrideMethods) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		method := r.Header.Get("X-HTTP-Method-Override")
+		if method == "" {
+			// a url encoded body is parsed here and kept on the request, the handler reads
+			// it from there; other bodies are left alone
+			method = r.FormValue("_method")
+		}
+		if method == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if !s.overrideMethods[method] {
+			WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: fmt.Sprintf("method override to %q is not allowed", method)})
+			return
+		}
+		r.Method = method
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMethodOverride(t *testing.T) {
+	form := "application/x-www-form-urlencoded"
+	tests := []struct {
+		name    string
+		methods []string
+		method  string
+		target  string
+		body    string
+		headers []string
+		want    int
+		// title is the note's title afterwards, empty when it is deleted
+		title string
+	}{
+		{"delete from a form", []string{"PUT", "DELETE"}, "POST", "/notes/1", "_method=DELETE", nil, http.StatusFound, ""},
+		{"lower case", []string{"PUT", "DELETE"}, "POST", "/notes/1", "_method=delete", nil, http.StatusFound, ""},
+		{"in the query", []string{"PUT", "DELETE"}, "POST", "/notes/1?_method=DELETE", "", nil, http.StatusFound, ""},
+		{"update from a header", []string{"PUT", "DELETE"}, "POST", "/notes/1", "title=Renamed&content=x", []string{"X-HTTP-Method-Override", "PUT"}, http.StatusFound, "Renamed"},
+		{"to GET", []string{"PUT", "DELETE"}, "POST", "/notes/1", "_method=GET", nil, http.StatusBadRequest, "Original"},
+		{"to an arbitrary method", []string{"PUT", "DELETE"}, "POST", "/notes/1", "_method=TRACE", nil, http.StatusBadRequest, "Original"},
+		{"to a method not configured", []string{"PUT"}, "POST", "/notes/1", "_method=DELETE", nil, http.StatusBadRequest, "Original"},
+		{"ignored on GET", []string{"PUT", "DELETE"}, "GET", "/notes/1?_method=DELETE", "", nil, http.StatusOK, "Original"},
+		{"off by default", nil, "POST", "/notes/1", "_method=DELETE", nil, http.StatusMethodNotAllowed, "Original"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t, WithMethodOverride(tt.methods))
+			storeTestNote(Note{ID: "1", Title: "Original", Content: "x", Created: time.Now()})
+
+			headers := append([]string{"Content-Type", form}, tt.headers...)
+			w := serve(h, tt.method, tt.target, tt.body, headers...)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if got := notes["1"].Title; got != tt.title {
+				t.Errorf("title = %q, want %q", got, tt.title)
+			}
+		})
+	}
+}
+
+func TestParseOverrideMethods(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []string
+		wantErr bool
+	}{
+		{"", []string{}, false},
+		{"put, patch,DELETE", []string{"PUT", "PATCH", "DELETE"}, false},
+		{"PUT,GET", nil, true},
+		{"CONNECT", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			got, err := parseOverrideMethods(tt.list)
+			if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseOverrideMethods(%q) = %v, %v, want %v", tt.list, got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WithDevMode turns on the tools for people working on the server itself, like the
+// template previews at /_preview/. It must never be on in production.
+func WithDevMode(dev bool) ServerOption {
+	return func(s *ApiServer) {
+		s.devMode = dev
+	}
+}
+
+// previewFixture is a page template and the sample data to render it with.
+type previewFixture struct {
+	page string
+	data func(s *ApiServer) any
+}
+
+// previewNotes are the sample notes every preview is filled with. They are made up and
+// never stored.
+func previewNotes() []Note {
+	now := time.Now()
+	return []Note{
+		{
+			ID:      "preview-1",
+			Title:   "Groceries",
+			Content: "Milk\nEggs\nBread\nA very long line that goes on and on to show how the page wraps text that does not fit on one line of the screen.",
+			Tags:    []string{"inbox", "errands"},
+			Created: now.Add(-30 * time.Minute),
+			Updated: now.Add(-10 * time.Minute),
+		},
+		{
+			ID:       "preview-2",
+			Title:    "Meeting notes",
+			Content:  "Discussed the roadmap. See [[preview-1]] for the shopping list.",
+			Tags:     []string{"work"},
+			Created:  now.Add(-26 * time.Hour),
+			Updated:  now.Add(-26 * time.Hour),
+			Locked:   true,
+			CSSClass: "theme-sample",
+		},
+		{
+			ID:      "preview-3",
+			Title:   "",
+			Content: "A note without a title.",
+			Created: now.Add(-72 * time.Hour),
+			Updated: now.Add(-72 * time.Hour),
+		},
+	}
+}
+
+// previewFixtures are the templates /_preview/ can render, keyed by the name in the path.
+var previewFixtures = map[string]previewFixture{
+	"index": {"index.html", func(s *ApiServer) any {
+		return IndexPage{baseTemplateData: s.baseData(), Notes: previewNotes()}
+	}},
+	"list": {"list.html", func(s *ApiServer) any {
+		return ListPage{
+			baseTemplateData: s.baseData(),
+			Notes:            s.listItems(previewNotes()),
+			Starred:          map[string]bool{"preview-1": true},
+			NextURL:          "/notes?cursor=preview",
+		}
+	}},
+	"empty-list": {"list.html", func(s *ApiServer) any {
+		return ListPage{baseTemplateData: s.baseData(), IsEmpty: true, EmptyMessage: s.emptyListMessage}
+	}},
+	"note": {"view.html", func(s *ApiServer) any {
+		note := previewNotes()[1]
+		return ViewPage{
+			baseTemplateData: s.baseData(),
+			Note:             note,
+			Description:      snippet(note.Content, 160),
+			Views:            42,
+			LinkedContent:    linkedContent(note.Content, s.allowedTags),
+		}
+	}},
+	"note-lines": {"view.html", func(s *ApiServer) any {
+		note := previewNotes()[0]
+		return ViewPage{
+			baseTemplateData: s.baseData(),
+			Note:             note,
+			Description:      snippet(note.Content, 160),
+			ShowLines:        true,
+			Lines:            numberLines(note.Content),
+			Views:            1,
+			LinkedContent:    linkedContent(note.Content, s.allowedTags),
+		}
+	}},
+	"edit": {"edit.html", func(s *ApiServer) any {
+		return EditPage{baseTemplateData: s.baseData(), MaxContentLength: s.maxContentLength}
+	}},
+	"error": {"error.html", func(s *ApiServer) any {
+		return s.errorPage("Something went wrong, this is a sample error")
+	}},
+	"search": {"search.html", func(s *ApiServer) any {
+		page := SearchPage{baseTemplateData: s.baseData(), Query: "line", Sort: "relevance"}
+		for _, note := range previewNotes() {
+			if score := s.scoreMatch(note, page.Query); score > 0 {
+				page.Results = append(page.Results, SearchResult{Note: note, Snippet: s.highlight(note.Content, page.Query), Score: score})
+			}
+		}
+		return page
+	}},
+	"timeline": {"timeline.html", func(s *ApiServer) any {
+		notes := previewNotes()
+		return TimelinePage{baseTemplateData: s.baseData(), Days: []TimelineDay{
+			{Label: "Today", Date: notes[0].Created, Notes: notes[:1]},
+			{Label: "Yesterday", Date: notes[1].Created, Notes: notes[1:2]},
+			{Label: notes[2].Created.Format("Monday, 2 January 2006"), Date: notes[2].Created, Notes: notes[2:]},
+		}}
+	}},
+	"print": {"print.html", func(s *ApiServer) any {
+		return PrintPage{baseTemplateData: s.baseData(), Notes: previewNotes()}
+	}},
+	"diff": {"diff.html", func(s *ApiServer) any {
+		note := previewNotes()[0]
+		return DiffPage{baseTemplateData: s.baseData(), Note: note, From: 1, To: 2, Ops: diffWords("Milk\nEggs", note.Content)}
+	}},
+}
+
+// preview handler
+// ---------------
+// previewHandler renders the template named in the path with sample data, so the look of
+// a page can be worked on without making real notes. The template is read from disk on
+// every request, so edits show on reload. It is only routed in dev mode.
+func (s *ApiServer) previewHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "GET" {
+		return s.methodNotAllowed(w, r, "GET")
+	}
+
+	fixture, ok := previewFixtures[strings.TrimPrefix(r.URL.Path, "/_preview/")]
+	if !ok {
+		return s.notFoundPage(w, "Unknown template")
+	}
+
+	tmpls, err := parseTemplateFiles(fixture.page)
+	if err != nil {
+		return WriteHTML(w, http.StatusInternalServerError, templates, "error.html", s.errorPage(err.Error()))
+	}
+	return WriteHTML(w, http.StatusOK, tmpls, fixture.page, fixture.data(s))
+}
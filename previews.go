@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+)
+
+// ListItem is a note as the list page shows it, with its title and content cut short
+// so long notes don't stretch the layout. The full note is still there for links.
+type ListItem struct {
+	Note
+	TitlePreview   string
+	ContentPreview string
+}
+
+// WithListPreviewLengths sets how many characters of a note's title and content the list
+// page shows. Zero leaves titles whole, or leaves the content out.
+func WithListPreviewLengths(title, content int) ServerOption {
+	return func(s *ApiServer) {
+		s.listTitleLength = title
+		s.listContentLength = content
+	}
+}
+
+// listItems prepares notes for list.html.
+func (s *ApiServer) listItems(list []Note) []ListItem {
+	items := make([]ListItem, len(list))
+	for i, note := range list {
+		items[i] = ListItem{Note: note, TitlePreview: note.Title}
+		if s.listTitleLength > 0 {
+			items[i].TitlePreview = truncateWords(note.Title, s.listTitleLength)
+		}
+		if s.listContentLength > 0 {
+			text := tagPattern.ReplaceAllString(note.Content, " ")
+			items[i].ContentPreview = truncateWords(text, s.listContentLength)
+		}
+	}
+	return items
+}
+
+// truncateWords returns text on a single line, cut to at most n characters. It cuts at
+// the last word boundary that fits and adds an ellipsis, unless the first word alone is
+// too long, which is cut where it has to be.
+func truncateWords(text string, n int) string {
+	text = strings.TrimSpace(whitespacePattern.ReplaceAllString(text, " "))
+
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+
+	// leave room for the ellipsis
+	cut := runes[:n-1]
+	if i := lastSpace(cut); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimSpace(string(cut)) + "…"
+}
+
+func lastSpace(runes []rune) int {
+	for i := len(runes) - 1; i >= 0; i-- {
+		if runes[i] == ' ' {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+)
+
+type PrintPage struct {
+	baseTemplateData
+	Notes []Note
+}
+
+// printHandler renders every note but the templates, or the ones matching the list
+// filters, on a single page meant for printing or saving, oldest first with a page break
+// between notes.
+func (s *ApiServer) printHandler(w http.ResponseWriter, r *http.Request) error {
+	filter, err := parseNoteFilter(r)
+	if err != nil {
+		return WriteHTML(w, http.StatusBadRequest, templates, "error.html", s.errorPage(err.Error()))
+	}
+
+	now := time.Now()
+	list := make([]Note, 0)
+	for _, note := range store.Snapshot() {
+		if !note.expired(now) && !note.IsTemplate && filter.match(note) {
+			list = append(list, note)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Created.Before(list[j].Created)
+	})
+
+	return WriteHTML(w, http.StatusOK, templates, "print.html", PrintPage{
+		baseTemplateData: s.baseData(),
+		Notes:            list,
+	})
+}
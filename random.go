@@ -0,0 +1,50 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// randomHandler picks a note at random, for rediscovering old ones. Browsers are
+// redirected to it, API clients get it as JSON. Templates and expired notes are never
+// picked.
+func (s *ApiServer) randomHandler(w http.ResponseWriter, r *http.Request) error {
+	note, ok := randomNote(time.Now())
+	if !ok {
+		if wantsJSON(r) {
+			return WriteJSON(r, w, http.StatusNotFound, ApiError{Error: "there are no notes"})
+		}
+		return s.notFoundPage(w, "There are no notes yet")
+	}
+
+	// every request should pick again, not replay a cached answer
+	w.Header().Set("Cache-Control", "no-store")
+	if wantsJSON(r) {
+		return WriteJSON(r, w, http.StatusOK, note)
+	}
+	http.Redirect(w, r, "/notes/"+note.ID, http.StatusFound)
+	return nil
+}
+
+// randomNote returns a uniformly random note, or false if there is none. Map iteration
+// order is unspecified rather than random, so taking the first note would favour some,
+// and it samples a reservoir of one instead: the i-th candidate replaces the pick with
+// probability 1/i. That is a single pass under the lock without copying the keys.
+func randomNote(now time.Time) (Note, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var pick Note
+	seen := 0
+	for _, note := range notes {
+		if note.expired(now) || note.IsTemplate {
+			continue
+		}
+		seen++
+		if rand.Intn(seen) == 0 {
+			pick = note
+		}
+	}
+	return pick, seen > 0
+}
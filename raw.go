@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// rawNote answers GET /notes/{id}/raw with just the note's content as plain text, for
+// curl and clipboard tools. Clients may keep it but must revalidate against the ETag, and
+// get a 304 without a body while it still matches.
+func (s *ApiServer) rawNote(w http.ResponseWriter, r *http.Request) error {
+	id := extractID(r.URL.Path)
+
+	mu.Lock()
+	note, ok := notes[id]
+	mu.Unlock()
+
+	if !ok || note.expired(time.Now()) {
+		return WriteBytes(w, http.StatusNotFound, "text/plain; charset=utf-8", []byte("Note not found\n"))
+	}
+
+	etag := noteETag(note)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("ETag", etag)
+	if ifNoneMatch(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	return WriteBytes(w, http.StatusOK, "text/plain; charset=utf-8", []byte(note.Content))
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+)
+
+// requestIDHeader carries a request's id in, from a proxy that assigned one, and out, on
+// the response and on the webhooks the request triggers.
+const requestIDHeader = "X-Request-ID"
+
+// requestIDPattern is what an incoming request id may look like. Anything else, which
+// could smuggle junk into logs and outgoing headers, is replaced with a fresh id.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type requestIDKey struct{}
+
+// withRequestID gives every request an id: the X-Request-ID it came with, if there is a
+// usable one, else a new random one. The id is echoed in the response's X-Request-ID.
+func (s *ApiServer) withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			var err error
+			if id, err = newLockToken(); err != nil {
+				id = s.generateID() // still unique enough to correlate by
+			}
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// requestID returns the id withRequestID gave r, or "" outside of a request.
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// types
+// -----
+// Route is one entry of the route registry Start builds the mux from.
+type Route struct {
+	Path string `json:"path"`
+	// Methods are the methods the route answers, OPTIONS aside, which is always answered.
+	// A route ending in / serves a whole subtree and checks the method per path itself,
+	// so for those these are the methods of the subtree as a whole.
+	Methods     []string `json:"methods"`
+	Description string   `json:"description"`
+
+	handler ApiFunc
+}
+
+// routes is the route registry: every route the server serves.
+func (s *ApiServer) routes() []Route {
+	routes := []Route{
+		{"/", []string{"GET", "HEAD"}, "The home page with the newest notes; every path no other route claims is a 404", s.indexHandler},
+		{"/notes", []string{"GET", "HEAD", "POST"}, "List notes, or create one", s.notesHandler},
+		{"/notes/", []string{"GET", "HEAD", "POST", "PUT", "DELETE"}, "A note and its sub-resources, by id", s.noteHandler},
+		{"/notes/new", []string{"GET"}, "The form for creating a note", s.newNoteHandler},
+		{"/notes/today", []string{"GET"}, "The notes created today", s.todayHandler},
+		{"/notes/random", []string{"GET"}, "A random note", s.randomHandler},
+		{"/notes/print", []string{"GET"}, "Every note on one printable page", s.printHandler},
+		{"/notes/merge", []string{"POST"}, "Merge notes into a new one", s.mergeHandler},
+		{"/notes/from-url", []string{"POST"}, "Clip a web page into a new note", s.noteFromURLHandler},
+		{"/timeline", []string{"GET"}, "The notes grouped by the day they were created", s.timelineHandler},
+		{"/events", []string{"GET"}, "A stream of note changes, as server-sent events", s.eventsHandler},
+		{"/api/batch", []string{"POST"}, "Create, update and delete notes in one request", s.batchHandler},
+		{"/api/routes", []string{"GET"}, "This list of routes", s.routesHandler},
+		{"/templates", []string{"GET"}, "The template notes", s.noteTemplatesHandler},
+		{"/favorites", []string{"GET"}, "The notes the current session has starred", s.favoritesHandler},
+		{"/export", []string{"GET"}, "Download every note as JSON", s.exportHandler},
+		{"/export/markdown", []string{"GET"}, "Download every note as one Markdown document", s.markdownExportHandler},
+		{"/import", []string{"POST"}, "Import notes from a JSON export", s.importHandler},
+		{"/import/markdown", []string{"POST"}, "Create a note from each uploaded .md file, titled with the file name", s.markdownImportHandler},
+		{"/suggest", []string{"GET"}, "Titles starting with a prefix, for autocomplete", s.suggestHandler},
+		{"/search", []string{"GET"}, "Search the notes", s.searchHandler},
+		{"/stats/memory", []string{"GET"}, "What the store is holding on to", s.memoryStatsHandler},
+		{"/admin/compact", []string{"POST"}, "Remove expired notes and stale drafts and trim note histories (admin)", s.compactHandler},
+		{"/admin/drain", []string{"GET", "POST", "DELETE"}, "Show, start or stop draining (admin)", s.drainHandler},
+		{"/healthz", []string{"GET"}, "Whether the server is alive", s.healthzHandler},
+		{"/readyz", []string{"GET"}, "Whether the server takes traffic", s.readyzHandler},
+		{"/metrics", []string{"GET"}, "Request metrics in the Prometheus text format", s.metricsHandler},
+		{"/version", []string{"GET"}, "The version of the server", s.versionHandler},
+		{"/openapi.json", []string{"GET"}, "The OpenAPI description of the server", s.openAPIHandler},
+	}
+	if s.devMode {
+		routes = append(routes, Route{"/_preview/", []string{"GET"}, "A page template rendered with sample data (dev mode)", s.previewHandler})
+	}
+	return routes
+}
+
+// allowMethods answers the methods a route doesn't serve with a 405, or a 204 for
+// OPTIONS, so the Allow header always comes from the registry. The paths below a subtree
+// route are left to check the method themselves, the route's own path is not.
+func (s *ApiServer) allowMethods(route Route) ApiFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		below := strings.HasSuffix(route.Path, "/") && r.URL.Path != route.Path
+		if !below && !slices.Contains(route.Methods, r.Method) {
+			return s.methodNotAllowed(w, r, route.Methods...)
+		}
+		return route.handler(w, r)
+	}
+}
+
+// routes handler
+// --------------
+// routesHandler lists the registered routes as JSON, for discovering what the server does.
+func (s *ApiServer) routesHandler(w http.ResponseWriter, r *http.Request) error {
+	return WriteJSON(r, w, http.StatusOK, s.routes())
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestRoutesHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		dev     bool
+		path    string
+		methods []string
+		listed  bool
+	}{
+		{"notes", false, "/notes", []string{"GET", "HEAD", "POST"}, true},
+		{"a note", false, "/notes/", []string{"GET", "HEAD", "POST", "PUT", "DELETE"}, true},
+		{"search", false, "/search", []string{"GET"}, true},
+		{"itself", false, "/api/routes", []string{"GET"}, true},
+		{"drain", false, "/admin/drain", []string{"GET", "POST", "DELETE"}, true},
+		{"previews outside dev mode", false, "/_preview/", nil, false},
+		{"previews in dev mode", true, "/_preview/", []string{"GET"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t, WithDevMode(tt.dev))
+			w := serve(h, "GET", "/api/routes", "")
+			var routes []Route
+			if err := json.Unmarshal(w.Body.Bytes(), &routes); err != nil {
+				t.Fatalf("invalid JSON: %v: %s", err, w.Body)
+			}
+
+			i := slices.IndexFunc(routes, func(route Route) bool { return route.Path == tt.path })
+			if listed := i >= 0; listed != tt.listed {
+				t.Fatalf("%s listed = %v, want %v", tt.path, listed, tt.listed)
+			}
+			if !tt.listed {
+				return
+			}
+			if !slices.Equal(routes[i].Methods, tt.methods) {
+				t.Errorf("%s methods = %v, want %v", tt.path, routes[i].Methods, tt.methods)
+			}
+			if routes[i].Description == "" {
+				t.Errorf("%s has no description", tt.path)
+			}
+		})
+	}
+}
+
+func TestAllowFromRegistry(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+		want   int
+		allow  string
+	}{
+		{"POST", "/", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS"},
+		{"DELETE", "/", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS"},
+		{"POST", "/nowhere", http.StatusNotFound, ""},
+		{"GET", "/", http.StatusOK, ""},
+		{"HEAD", "/", http.StatusOK, ""},
+		{"DELETE", "/search", http.StatusMethodNotAllowed, "GET, OPTIONS"},
+		{"PUT", "/notes", http.StatusMethodNotAllowed, "GET, HEAD, POST, OPTIONS"},
+		{"GET", "/import", http.StatusMethodNotAllowed, "POST, OPTIONS"},
+		{"PATCH", "/admin/drain", http.StatusMethodNotAllowed, "GET, POST, DELETE, OPTIONS"},
+		{"OPTIONS", "/api/routes", http.StatusNoContent, "GET, OPTIONS"},
+		{"OPTIONS", "/notes", http.StatusNoContent, "GET, HEAD, POST, OPTIONS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			_, h := newTestServer(t)
+			w := serve(h, tt.method, tt.target, "")
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if got := w.Header().Get("Allow"); got != tt.allow {
+				t.Errorf("Allow = %q, want %q", got, tt.allow)
+			}
+		})
+	}
+}
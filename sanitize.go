@@ -0,0 +1,116 @@
+package main
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// inlineTags are the tags WithAllowedTags may allow: inline formatting that can't run
+// scripts, load anything or break out of the note's paragraph.
+var inlineTags = map[string]bool{
+	"a": true, "b": true, "i": true, "em": true, "strong": true, "u": true,
+	"s": true, "code": true, "mark": true, "sub": true, "sup": true,
+}
+
+var (
+	// htmlTagPattern matches an opening or closing tag: the slash, the name and the attributes.
+	htmlTagPattern = regexp.MustCompile(`<(/?)([A-Za-z][A-Za-z0-9]*)([^<>]*)>`)
+
+	// hrefPattern matches a quoted or unquoted href attribute.
+	hrefPattern = regexp.MustCompile(`(?i)\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// WithAllowedTags keeps the given inline tags (see inlineTags) in rendered note content
+// and strips every other tag. Kept tags lose their attributes, except a safe href on a
+// link. With no tags, the default, all content is escaped. Unlike a trusted note this
+// applies to every note and can't run scripts.
+func WithAllowedTags(tags []string) ServerOption {
+	return func(s *ApiServer) {
+		s.allowedTags = make(map[string]bool, len(tags))
+		for _, tag := range tags {
+			s.allowedTags[strings.ToLower(tag)] = true
+		}
+	}
+}
+
+// sanitizeHTML renders content keeping only the allowed tags. The text between tags goes
+// through text, which must escape it. Disallowed tags are dropped with their attributes,
+// their text is kept. Closing tags that don't match an open one are dropped, and tags
+// still open at the end are closed, so the result can't unbalance the page. With nothing
+// allowed, all of content is text.
+func sanitizeHTML(content string, allowed map[string]bool, text func(string) string) string {
+	if len(allowed) == 0 {
+		return text(content)
+	}
+
+	var b strings.Builder
+	var open []string
+	last := 0
+	for _, loc := range htmlTagPattern.FindAllStringSubmatchIndex(content, -1) {
+		b.WriteString(text(content[last:loc[0]]))
+		last = loc[1]
+
+		name := strings.ToLower(content[loc[4]:loc[5]])
+		if !allowed[name] {
+			continue
+		}
+
+		if closing := loc[3] > loc[2]; !closing {
+			b.WriteString(openTag(name, content[loc[6]:loc[7]]))
+			open = append(open, name)
+			continue
+		}
+
+		// close everything opened after the matching tag too, so tags stay nested
+		for i := len(open) - 1; i >= 0; i-- {
+			if open[i] != name {
+				continue
+			}
+			for j := len(open) - 1; j >= i; j-- {
+				b.WriteString("</" + open[j] + ">")
+			}
+			open = open[:i]
+			break
+		}
+	}
+	b.WriteString(text(content[last:]))
+
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i] + ">")
+	}
+	return b.String()
+}
+
+// openTag returns a clean opening tag. Links keep their href if it is safe, and get
+// rel="nofollow noopener" since anyone can write them.
+func openTag(name, attrs string) string {
+	if name != "a" {
+		return "<" + name + ">"
+	}
+
+	match := hrefPattern.FindStringSubmatch(attrs)
+	if match == nil {
+		return "<a>"
+	}
+	href := html.UnescapeString(match[1] + match[2] + match[3])
+	if !safeHref(href) {
+		return "<a>"
+	}
+	return `<a href="` + html.EscapeString(href) + `" rel="nofollow noopener">`
+}
+
+// safeHref reports whether a link target can't run script: a relative url, or an
+// absolute one with an http, https or mailto scheme.
+func safeHref(href string) bool {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+		return true
+	}
+	return false
+}
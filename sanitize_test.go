@@ -0,0 +1,72 @@
+package main
+
+import (
+	"html"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	inline := map[string]bool{"b": true, "i": true, "a": true, "code": true}
+	tests := []struct {
+		name    string
+		allowed map[string]bool
+		content string
+		want    string
+	}{
+		{"nothing allowed escapes everything", nil, "<b>bold</b>", "&lt;b&gt;bold&lt;/b&gt;"},
+		{"allowed tags kept", inline, "<b>bold</b> and <i>it</i>", "<b>bold</b> and <i>it</i>"},
+		{"tag names are case insensitive", inline, "<B>bold</B>", "<b>bold</b>"},
+		{"script stripped, text kept", inline, "<script>alert(1)</script>", "alert(1)"},
+		{"disallowed tags stripped", inline, `<div><img src="x.png">hi</div>`, "hi"},
+		{"not allowed here", map[string]bool{"b": true}, "<i>it</i>", "it"},
+		{"attributes dropped", inline, `<b onclick="steal()" class="x">bold</b>`, "<b>bold</b>"},
+		{"safe link kept", inline, `<a href="https://example.com" onclick="x()">go</a>`, `<a href="https://example.com" rel="nofollow noopener">go</a>`},
+		{"script link dropped", inline, `<a href="javascript:alert(1)">go</a>`, "<a>go</a>"},
+		{"encoded script link dropped", inline, `<a href="&#106;avascript:alert(1)">go</a>`, "<a>go</a>"},
+		{"unclosed tag closed", inline, "<b>bold", "<b>bold</b>"},
+		{"stray closing tag dropped", inline, "bold</b>", "bold"},
+		{"misnested tags stay nested", inline, "<b><i>both</b> after</i>", "<b><i>both</i></b> after"},
+		{"text is escaped", inline, "<b>1 < 2 & 3</b>", "<b>1 &lt; 2 &amp; 3</b>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sanitizeHTML(tt.content, tt.allowed, html.EscapeString)
+			if got != tt.want {
+				t.Errorf("sanitizeHTML(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestViewNoteAllowedTags(t *testing.T) {
+	content := `<b>bold</b><script>alert(1)</script><iframe src="https://evil.example"></iframe>`
+	tests := []struct {
+		name   string
+		tags   []string
+		want   []string
+		absent []string
+	}{
+		{"default escapes", nil, []string{"&lt;b&gt;bold&lt;/b&gt;", "&lt;script&gt;"}, []string{"<b>bold", "<script>"}},
+		{"allowlist", []string{"b", "i"}, []string{"<b>bold</b>alert(1)"}, []string{"<script>", "<iframe", "&lt;script&gt;"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t, WithAllowedTags(tt.tags))
+			storeTestNote(Note{ID: "1", Title: "Note", Content: content, Created: time.Now()})
+
+			body := serve(h, "GET", "/notes/1/note", "").Body.String()
+			for _, want := range tt.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("view is missing %q", want)
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(body, absent) {
+					t.Errorf("view contains %q", absent)
+				}
+			}
+		})
+	}
+}
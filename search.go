@@ -0,0 +1,296 @@
+package main
+
+import (
+	"html/template"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// searchContext is how many characters highlight keeps on each side of a match.
+const searchContext = 60
+
+// titleMatchScore is what a title match is worth in scoreMatch. Occurrences in the
+// content are capped below it, so any title match outranks any number of content ones.
+const titleMatchScore = 1000
+
+// searchSorts are the orders /search can list results in.
+var searchSorts = map[string]bool{"relevance": true, "recent": true}
+
+type SearchPage struct {
+	baseTemplateData
+	Query   string
+	Sort    string
+	Results []SearchResult
+}
+
+// SearchResult is a matching note with a snippet of its content around the match.
+type SearchResult struct {
+	Note    Note          `json:"note"`
+	Snippet template.HTML `json:"snippet"`
+	// Score is how well the note matches, see scoreMatch
+	Score int `json:"score"`
+}
+
+// WithSearchSort sets the order /search lists results in when the client doesn't pick
+// one with ?sort=: "relevance", the default, or "recent".
+func WithSearchSort(name string) ServerOption {
+	return func(s *ApiServer) {
+		s.searchSort = name
+	}
+}
+
+// WithSearchNormalization makes /search and /suggest ignore accents and other marks as
+// well as case, so "cafe" finds "café". Off by default, for those who want exact
+// matching of everything but case.
+func WithSearchNormalization(normalize bool) ServerOption {
+	return func(s *ApiServer) {
+		s.normalizeSearch = normalize
+	}
+}
+
+// searchHandler lists the notes whose title or content contains ?q=, ignoring case. They
+// are ranked best match first, or with ?sort=recent newest first. Each result carries a
+// snippet with the match highlighted.
+func (s *ApiServer) searchHandler(w http.ResponseWriter, r *http.Request) error {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	sortName := r.URL.Query().Get("sort")
+	if !searchSorts[sortName] {
+		sortName = s.searchSort
+	}
+	results := make([]SearchResult, 0)
+
+	if query != "" {
+		now := time.Now()
+		for _, note := range store.Snapshot() {
+			if note.expired(now) || note.IsTemplate {
+				continue
+			}
+			if score := s.scoreMatch(note, query); score > 0 {
+				results = append(results, SearchResult{Note: note, Snippet: s.highlight(note.Content, query), Score: score})
+			}
+		}
+		sort.Slice(results, func(i, j int) bool {
+			if sortName == "relevance" && results[i].Score != results[j].Score {
+				return results[i].Score > results[j].Score
+			}
+			return results[i].Note.Created.After(results[j].Note.Created)
+		})
+	}
+
+	if wantsJSON(r) {
+		return WriteJSON(r, w, http.StatusOK, results)
+	}
+
+	return WriteHTML(w, http.StatusOK, templates, "search.html", SearchPage{
+		baseTemplateData: s.baseData(),
+		Query:            query,
+		Sort:             sortName,
+		Results:          results,
+	})
+}
+
+// scoreMatch rates how well note matches query, 0 for not at all. Matches in the title
+// count for more than any number in the content, and within each, more occurrences
+// score higher. Ties are left to the caller, which breaks them by recency.
+func (s *ApiServer) scoreMatch(note Note, query string) int {
+	score := s.count(note.Content, query, titleMatchScore-1)
+	if n := s.count(note.Title, query, math.MaxInt); n > 0 {
+		score += titleMatchScore * n
+	}
+	return score
+}
+
+// count returns how many times query occurs in text, without overlaps, as the server
+// matches searches. It stops counting at limit.
+func (s *ApiServer) count(text, query string, limit int) int {
+	if s.normalizeSearch {
+		folded := foldText([]rune(text))
+		q := []rune(normalizeForSearch(query))
+		n := 0
+		for from := 0; n < limit; n++ {
+			if _, _, from = folded.match(q, from); from < 0 {
+				break
+			}
+		}
+		return n
+	}
+
+	runes, q := []rune(text), []rune(query)
+	n := 0
+	for offset := 0; offset < len(runes) && n < limit; n++ {
+		_, end := indexFold(runes[offset:], q)
+		if end < 0 {
+			break
+		}
+		offset += end
+	}
+	return n
+}
+
+// index returns the rune offsets in text of the first match of query, or -1, -1.
+func (s *ApiServer) index(text []rune, query string) (int, int) {
+	if s.normalizeSearch {
+		return indexNormalized(text, query)
+	}
+	return indexFold(text, []rune(query))
+}
+
+// indexFold returns the rune offsets of the first occurrence of query in text, ignoring
+// case, or -1, -1. It compares runes rather than lower casing both strings, because
+// lower casing can change a string's length and throw the offsets off.
+func indexFold(text, query []rune) (int, int) {
+	if len(query) == 0 {
+		return -1, -1
+	}
+	for i := 0; i+len(query) <= len(text); i++ {
+		if equalFoldRunes(text[i:i+len(query)], query) {
+			return i, i + len(query)
+		}
+	}
+	return -1, -1
+}
+
+// equalFoldRunes is strings.EqualFold for rune slices of the same length, without
+// converting them to strings.
+func equalFoldRunes(a, b []rune) bool {
+	for i, r := range a {
+		if r == b[i] {
+			continue
+		}
+		if r < utf8.RuneSelf && b[i] < utf8.RuneSelf {
+			if unicode.ToLower(r) != unicode.ToLower(b[i]) {
+				return false
+			}
+			continue
+		}
+		// runes that fold to each other are on one SimpleFold orbit
+		f := unicode.SimpleFold(r)
+		for f != r && f != b[i] {
+			f = unicode.SimpleFold(f)
+		}
+		if f == r {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeForSearch folds s for accent-insensitive matching: compatibility decomposed
+// (NFKD), stripped of combining marks and lower cased. "Café" and "CAFE" both become
+// "cafe", and so does "ｃａｆｅ".
+func normalizeForSearch(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		b.WriteString(foldRune(r))
+	}
+	return b.String()
+}
+
+// foldRune is normalizeForSearch for a single rune. Folding rune by rune gives the same
+// result as folding the whole string, since the marks that decomposition would reorder
+// are all stripped, and it tells which rune each folded one came from.
+func foldRune(r rune) string {
+	var b strings.Builder
+	for _, d := range norm.NFKD.String(string(r)) {
+		if !unicode.Is(unicode.Mn, d) {
+			b.WriteRune(unicode.ToLower(d))
+		}
+	}
+	return b.String()
+}
+
+// foldedText is a text folded with foldRune, and for each folded rune the text rune it
+// came from, so a match in the folded runes can be found in the original.
+type foldedText struct {
+	text   []rune
+	runes  []rune
+	origin []int
+}
+
+func foldText(text []rune) foldedText {
+	f := foldedText{text: text, runes: make([]rune, 0, len(text)), origin: make([]int, 0, len(text))}
+	for i, r := range text {
+		// ASCII has nothing to decompose, so it only needs lower casing
+		if r < utf8.RuneSelf {
+			f.runes = append(f.runes, unicode.ToLower(r))
+			f.origin = append(f.origin, i)
+			continue
+		}
+		for _, d := range foldRune(r) {
+			f.runes = append(f.runes, d)
+			f.origin = append(f.origin, i)
+		}
+	}
+	return f
+}
+
+// match finds query, already normalized, in the folded runes from offset from on. It
+// returns the text offsets of the match and the folded offset to look for the next one
+// from, or -1, -1, -1.
+func (f foldedText) match(query []rune, from int) (int, int, int) {
+	if len(query) == 0 {
+		return -1, -1, -1
+	}
+	for i := from; i+len(query) <= len(f.runes); i++ {
+		if slices.Equal(f.runes[i:i+len(query)], query) {
+			// take in the marks that follow, they belong to the last matched letter
+			end := f.origin[i+len(query)-1] + 1
+			for end < len(f.text) && foldRune(f.text[end]) == "" {
+				end++
+			}
+			next := i + len(query)
+			for next < len(f.runes) && f.origin[next] < end {
+				next++
+			}
+			return f.origin[i], end, next
+		}
+	}
+	return -1, -1, -1
+}
+
+// indexNormalized is indexFold comparing normalizeForSearch forms. The offsets are still
+// those of text, so the match can be highlighted in the original.
+func indexNormalized(text []rune, query string) (int, int) {
+	start, end, _ := foldText(text).match([]rune(normalizeForSearch(query)), 0)
+	return start, end
+}
+
+// highlight returns a window of content around the first match of query, with the match
+// wrapped in <mark>. Everything else is escaped, so the result is safe to render as is.
+// Like snippet, it works on the plain text: HTML tags are dropped and runs of whitespace
+// collapsed so the snippet fits on one line. An ellipsis marks content cut off at either
+// end. Content without a match yields its start instead.
+func (s *ApiServer) highlight(content, query string) template.HTML {
+	plain := tagPattern.ReplaceAllString(content, " ")
+	text := []rune(strings.TrimSpace(whitespacePattern.ReplaceAllString(plain, " ")))
+
+	start, end := s.index(text, query)
+	if start < 0 {
+		return template.HTML(template.HTMLEscapeString(snippet(content, 2*searchContext)))
+	}
+
+	from := max(0, start-searchContext)
+	to := min(len(text), end+searchContext)
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	b.WriteString(template.HTMLEscapeString(string(text[from:start])))
+	b.WriteString("<mark>")
+	b.WriteString(template.HTMLEscapeString(string(text[start:end])))
+	b.WriteString("</mark>")
+	b.WriteString(template.HTMLEscapeString(string(text[end:to])))
+	if to < len(text) {
+		b.WriteString("…")
+	}
+	return template.HTML(b.String())
+}
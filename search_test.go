@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchRanking(t *testing.T) {
+	now := time.Now()
+	corpus := []Note{
+		{ID: "1", Title: "Go tips", Content: "nothing", Created: now.Add(-4 * time.Hour)},
+		{ID: "2", Title: "Notes", Content: "go go go", Created: now.Add(-time.Hour)},
+		{ID: "3", Title: "Other", Content: "Go once", Created: now},
+		{ID: "4", Title: "Go Go", Content: "go", Created: now.Add(-5 * time.Hour)},
+		{ID: "5", Title: "Also go", Content: "", Created: now.Add(-2 * time.Hour)},
+		{ID: "6", Title: "Unrelated", Content: "nope", Created: now},
+	}
+
+	tests := []struct {
+		name       string
+		defaultBy  string
+		target     string
+		want       []string
+		wantScores []int
+	}{
+		// title matches first, more of them first, ties newest first
+		{"relevance", "relevance", "/search?q=go", []string{"4", "5", "1", "2", "3"}, []int{2001, 1000, 1000, 3, 1}},
+		{"recent", "relevance", "/search?q=go&sort=recent", []string{"3", "2", "5", "1", "4"}, []int{1, 3, 1000, 1000, 2001}},
+		{"recent by default", "recent", "/search?q=GO", []string{"3", "2", "5", "1", "4"}, []int{1, 3, 1000, 1000, 2001}},
+		{"unknown sort falls back", "relevance", "/search?q=go&sort=title", []string{"4", "5", "1", "2", "3"}, []int{2001, 1000, 1000, 3, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t, WithSearchSort(tt.defaultBy))
+			for _, note := range corpus {
+				storeTestNote(note)
+			}
+
+			w := serve(h, "GET", tt.target, "", "Accept", "application/json")
+			var results []SearchResult
+			if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+				t.Fatalf("invalid JSON: %v: %s", err, w.Body)
+			}
+			var ids []string
+			var scores []int
+			for _, result := range results {
+				ids = append(ids, result.Note.ID)
+				scores = append(scores, result.Score)
+			}
+			if !slices.Equal(ids, tt.want) || !slices.Equal(scores, tt.wantScores) {
+				t.Errorf("results %v scored %v, want %v scored %v", ids, scores, tt.want, tt.wantScores)
+			}
+		})
+	}
+}
+
+func TestScoreMatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		normalize bool
+		note      Note
+		query     string
+		want      int
+	}{
+		{"no match", false, Note{Title: "Title", Content: "content"}, "zzz", 0},
+		{"content", false, Note{Title: "Title", Content: "one two one"}, "one", 2},
+		{"title", false, Note{Title: "One", Content: "two"}, "one", titleMatchScore},
+		{"both", false, Note{Title: "One", Content: "one one"}, "ONE", titleMatchScore + 2},
+		{"occurrences don't overlap", false, Note{Title: "x", Content: "aaaa"}, "aa", 2},
+		{"content stays below a title match", false, Note{Title: "x", Content: strings.Repeat("a ", 5000)}, "a", titleMatchScore - 1},
+		{"accents count when normalized", true, Note{Title: "Café", Content: "cafe CAFÉ"}, "cafe", titleMatchScore + 2},
+		{"accents must match otherwise", false, Note{Title: "Café", Content: "cafe CAFÉ"}, "cafe", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewHTMLServer(":0", WithSearchNormalization(tt.normalize))
+			if got := s.scoreMatch(tt.note, tt.query); got != tt.want {
+				t.Errorf("scoreMatch(%q) = %d, want %d", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeForSearch(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"cafe", "cafe"},
+		{"Café", "cafe"},
+		{"CAFÉ", "cafe"},
+		{"café", "cafe"},
+		{"Ｃａｆｅ", "cafe"},
+		{"naïve Ångström", "naive angstrom"},
+		{"ﬁle", "file"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := normalizeForSearch(tt.in); got != tt.want {
+				t.Errorf("normalizeForSearch(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchNormalization(t *testing.T) {
+	tests := []struct {
+		name      string
+		normalize bool
+		query     string
+		want      []string
+	}{
+		{"plain query finds accents", true, "cafe", []string{"1", "2"}},
+		{"accented query finds plain", true, "CAFÉ", []string{"1", "2"}},
+		{"in the content", true, "creme brulee", []string{"2"}},
+		{"exact without it", false, "cafe", []string{"2"}},
+		{"accents must match without it", false, "café", []string{"1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t, WithSearchNormalization(tt.normalize))
+			storeTestNote(Note{ID: "1", Title: "Café menu", Content: "coffee", Created: time.Now()})
+			storeTestNote(Note{ID: "2", Title: "Cafeteria", Content: "Crème brûlée", Created: time.Now().Add(-time.Hour)})
+
+			w := serve(h, "GET", "/search?q="+url.QueryEscape(tt.query), "", "Accept", "application/json")
+			var results []SearchResult
+			if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+				t.Fatalf("invalid JSON: %v: %s", err, w.Body)
+			}
+			var got []string
+			for _, result := range results {
+				got = append(got, result.Note.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("search %q = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuggestNormalization(t *testing.T) {
+	tests := []struct {
+		name      string
+		normalize bool
+		query     string
+		want      []string
+	}{
+		{"plain prefix finds accents", true, "cafe", []string{"1", "2"}},
+		{"accented prefix finds plain", true, "Éco", []string{"3"}},
+		{"exact without it", false, "cafe", []string{"2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t, WithSearchNormalization(tt.normalize))
+			storeTestNote(Note{ID: "1", Title: "Café menu", Created: time.Now()})
+			storeTestNote(Note{ID: "2", Title: "Cafeteria", Created: time.Now()})
+			storeTestNote(Note{ID: "3", Title: "Economy", Created: time.Now()})
+
+			w := serve(h, "GET", "/suggest?q="+url.QueryEscape(tt.query), "")
+			var suggestions []Suggestion
+			if err := json.Unmarshal(w.Body.Bytes(), &suggestions); err != nil {
+				t.Fatalf("invalid JSON: %v: %s", err, w.Body)
+			}
+			var got []string
+			for _, suggestion := range suggestions {
+				got = append(got, suggestion.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("suggest %q = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHighlightNormalized(t *testing.T) {
+	s := NewHTMLServer(":0", WithSearchNormalization(true))
+	tests := []struct {
+		content, query string
+		want           string
+	}{
+		{"Meet at the café", "cafe", "Meet at the <mark>café</mark>"},
+		{"Meet at the café now", "CAFE", "Meet at the <mark>café</mark> now"},
+		{"a &lt; b: Crème", "creme", "a &amp;lt; b: <mark>Crème</mark>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := string(s.highlight(tt.content, tt.query)); got != tt.want {
+				t.Errorf("highlight(%q, %q) = %q, want %q", tt.content, tt.query, got, tt.want)
+			}
+		})
+	}
+}
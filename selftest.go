@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// selfTestStep is one check of the self-test.
+type selfTestStep struct {
+	name string
+	run  func() error
+}
+
+// SelfTest exercises ns and the page templates the way a request would: it creates a
+// note, reads it back, renders it, updates it and deletes it, logging PASS or FAIL for
+// each step. It stops at the first failure and returns it. The test note is removed
+// whatever happens, so it is safe to run against a store that holds real notes.
+func (s *ApiServer) SelfTest(ns NoteStore) error {
+	note := Note{
+		ID:      s.generateID(),
+		Title:   "self-test",
+		Content: "written by the startup self-test",
+		Created: time.Now(),
+	}
+	defer ns.WithTx(func(tx Tx) error {
+		tx.Delete(note.ID)
+		return nil
+	})
+
+	steps := []selfTestStep{
+		{"ping", func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+			defer cancel()
+			return ns.Ping(ctx)
+		}},
+		{"create", func() error {
+			if err := s.validateNote(note); err != nil {
+				return err
+			}
+			return ns.WithTx(func(tx Tx) error {
+				tx.Put(note)
+				return nil
+			})
+		}},
+		{"read", func() error {
+			return expectNote(ns, note)
+		}},
+		{"render", func() error {
+			if _, err := renderHTML("view.html", ViewPage{baseTemplateData: s.baseData(), Note: note}); err != nil {
+				return err
+			}
+			_, err := renderHTML("list.html", ListPage{baseTemplateData: s.baseData(), Notes: s.listItems([]Note{note})})
+			return err
+		}},
+		{"update", func() error {
+			note.Content = "updated by the startup self-test"
+			if err := ns.WithTx(func(tx Tx) error {
+				tx.Put(note)
+				return nil
+			}); err != nil {
+				return err
+			}
+			return expectNote(ns, note)
+		}},
+		{"delete", func() error {
+			if err := ns.WithTx(func(tx Tx) error {
+				tx.Delete(note.ID)
+				return nil
+			}); err != nil {
+				return err
+			}
+			var found bool
+			ns.WithTx(func(tx Tx) error {
+				_, found = tx.Get(note.ID)
+				return nil
+			})
+			if found {
+				return errors.New("the note is still there")
+			}
+			return nil
+		}},
+	}
+
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			log.Printf("selftest: %s FAIL: %v", step.name, err)
+			return fmt.Errorf("%s: %w", step.name, err)
+		}
+		log.Printf("selftest: %s PASS", step.name)
+	}
+	return nil
+}
+
+// expectNote checks that ns holds want as it was written.
+func expectNote(ns NoteStore, want Note) error {
+	var got Note
+	var found bool
+	ns.WithTx(func(tx Tx) error {
+		got, found = tx.Get(want.ID)
+		return nil
+	})
+	if !found {
+		return errors.New("the note is missing")
+	}
+	if got.Title != want.Title || got.Content != want.Content {
+		return fmt.Errorf("read back %q / %q, wrote %q / %q", got.Title, got.Content, want.Title, want.Content)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// maxSlugLength is the most characters a slug keeps from the title.
+const maxSlugLength = 60
+
+// noteActions are the sub-resources noteHandler routes under /notes/{id}/. A slug can't
+// be one of them, or its pretty URL would hit the action instead of the note.
+var noteActions = map[string]bool{
+	"lock": true, "unlock": true, "diff": true, "draft": true,
+	"tags": true, "star": true, "trust": true, "raw": true,
+	"backlinks": true, "split": true, "protect": true,
+}
+
+// slugify turns a title into a readable URL segment: lower case letters and digits in
+// any script, with every run of anything else collapsed into a single hyphen.
+func slugify(title string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+
+	slug := []rune(b.String())
+	if len(slug) > maxSlugLength {
+		slug = slug[:maxSlugLength]
+	}
+	return strings.Trim(string(slug), "-")
+}
+
+// Slug is the note's canonical slug, as used in /notes/{id}/{slug}. It can be empty,
+// for a title without any letters or digits.
+func (n Note) Slug() string {
+	slug := slugify(n.Title)
+	if noteActions[slug] {
+		slug += "-note"
+	}
+	return slug
+}
+
+// redirectToSlug sends a note requested under the wrong slug to its canonical URL.
+// It reports whether it did.
+func redirectToSlug(w http.ResponseWriter, r *http.Request, note Note) bool {
+	slug := extractAction(r.URL.Path)
+	if slug == "" || slug == note.Slug() {
+		return false
+	}
+
+	target := "/notes/" + note.ID
+	if canonical := note.Slug(); canonical != "" {
+		target += "/" + url.PathEscape(canonical)
+	}
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+	return true
+}
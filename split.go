@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SplitResult struct {
+	// Original is the ID of the note that was split, which keeps the first part
+	Original string `json:"original"`
+	// New is the ID of the note created with the second part
+	New string `json:"new"`
+}
+
+// splitPoint is where to split a note's content. Exactly one of its fields is set.
+type splitPoint struct {
+	line   int    // the second part starts with this line, counting from 1
+	offset int    // the second part starts at this character
+	marker string // the second part starts after the first occurrence of this, which is dropped
+}
+
+// parseSplitPoint reads the line, offset or marker form value.
+func parseSplitPoint(r *http.Request) (splitPoint, error) {
+	line, offset, marker := r.FormValue("line"), r.FormValue("offset"), r.FormValue("marker")
+
+	set := 0
+	for _, v := range []string{line, offset, marker} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return splitPoint{}, errors.New("give exactly one of line, offset or marker")
+	}
+
+	var point splitPoint
+	var err error
+	switch {
+	case line != "":
+		if point.line, err = strconv.Atoi(line); err != nil {
+			return splitPoint{}, fmt.Errorf("invalid line %q", line)
+		}
+	case offset != "":
+		if point.offset, err = strconv.Atoi(offset); err != nil {
+			return splitPoint{}, fmt.Errorf("invalid offset %q", offset)
+		}
+	default:
+		point.marker = marker
+	}
+	return point, nil
+}
+
+// split cuts content in two at the point. Both parts must have something in them, so a
+// point at either end of the content is out of range.
+func (p splitPoint) split(content string) (string, string, error) {
+	var before, after string
+	switch {
+	case p.marker != "":
+		var found bool
+		if before, after, found = strings.Cut(content, p.marker); !found {
+			return "", "", fmt.Errorf("marker %q is not in the content", p.marker)
+		}
+	case p.line != 0:
+		lines := strings.SplitAfter(content, "\n")
+		if p.line < 2 || p.line > len(lines) {
+			return "", "", fmt.Errorf("line %d is out of range, the note has %d lines", p.line, len(lines))
+		}
+		before, after = strings.Join(lines[:p.line-1], ""), strings.Join(lines[p.line-1:], "")
+	default:
+		runes := []rune(content)
+		if p.offset < 1 || p.offset >= len(runes) {
+			return "", "", fmt.Errorf("offset %d is out of range, the content has %d characters", p.offset, len(runes))
+		}
+		before, after = string(runes[:p.offset]), string(runes[p.offset:])
+	}
+
+	if strings.TrimSpace(before) == "" || strings.TrimSpace(after) == "" {
+		return "", "", errors.New("both parts of a split need some content")
+	}
+	return before, after, nil
+}
+
+// split handler
+// -------------
+// splitNote splits a note in two: the note keeps the content before the split point and
+// a new note gets the rest. Both are titled after the original with a part suffix, and
+// are written in one transaction. The point is given as a line, a character offset or a
+// marker string.
+func (s *ApiServer) splitNote(w http.ResponseWriter, r *http.Request) error {
+	id := extractID(r.URL.Path)
+
+	if err := s.parseForm(r); err != nil {
+		return WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: err.Error()})
+	}
+	point, err := parseSplitPoint(r)
+	if err != nil {
+		return WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: err.Error()})
+	}
+	token := lockToken(r)
+
+	var result SplitResult
+	var status int
+	var message string
+	// invalid is set instead when the new note fails validation, to report it field by field
+	var invalid error
+	fail := func(code int, msg string) error {
+		status, message = code, msg
+		return errRollback
+	}
+
+	err = store.WithTx(func(tx Tx) error {
+		now := time.Now()
+		note, ok := tx.Get(id)
+		if !ok || note.expired(now) {
+			return fail(http.StatusNotFound, "Note not found")
+		}
+		if note.Locked {
+			return fail(http.StatusForbidden, errReadOnly)
+		}
+		if lock, held := s.activeLock(id); held && lock.Token != token {
+			return fail(http.StatusLocked, "Note is locked by another editor")
+		}
+
+		before, after, err := point.split(note.Content)
+		if err != nil {
+			return fail(http.StatusBadRequest, err.Error())
+		}
+
+		// both contents change, so neither stays trusted
+		first := note.clone()
+		first.Title = note.Title + " (part 1)"
+		first.Content = before
+		first.Trusted = false
+
+		second := note.clone()
+		second.ID = s.generateID()
+		second.Title = note.Title + " (part 2)"
+		second.Content = after
+		second.Created = now
+		second.Trusted = false
+
+		for _, part := range []Note{first, second} {
+			if invalid = s.validateNote(part); invalid != nil {
+				return errRollback
+			}
+		}
+
+		tx.Put(first)
+		tx.Put(second)
+		if s.maxTotalNotes > 0 && tx.Count() > s.maxTotalNotes {
+			return fail(http.StatusInsufficientStorage, errNoteLimit(s.maxTotalNotes).Error())
+		}
+
+		result = SplitResult{Original: first.ID, New: second.ID}
+		return nil
+	})
+	if invalid != nil {
+		return WriteJSON(r, w, http.StatusBadRequest, validationBody(invalid))
+	}
+	if status != 0 {
+		return WriteJSON(r, w, status, ApiError{Error: message})
+	}
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("X-Note-ID", result.New)
+	return WriteJSON(r, w, http.StatusCreated, result)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// there are no user accounts, so stars belong to a browser session identified by a cookie
+const sessionCookie = "session"
+
+// starred note ids keyed by session id. They have their own lock; when both are needed,
+// take mu first.
+var (
+	stars   = make(map[string]map[string]bool)
+	starsMu = &sync.Mutex{}
+)
+
+// readSession returns the session id of the request, or "" if it has none yet.
+func readSession(r *http.Request) string {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// ensureSession returns the session id of the request, starting a new session if needed.
+func ensureSession(w http.ResponseWriter, r *http.Request) (string, error) {
+	if id := readSession(r); id != "" {
+		return id, nil
+	}
+
+	id, err := newLockToken()
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return id, nil
+}
+
+// starredNotes returns the set of note ids a session has starred. The set is a copy.
+func starredNotes(session string) map[string]bool {
+	starsMu.Lock()
+	defer starsMu.Unlock()
+
+	starred := make(map[string]bool, len(stars[session]))
+	for id := range stars[session] {
+		starred[id] = true
+	}
+	return starred
+}
+
+// toggleStarred flips whether a session has starred a note and returns the new state.
+func toggleStarred(session, id string) bool {
+	starsMu.Lock()
+	defer starsMu.Unlock()
+
+	if stars[session] == nil {
+		stars[session] = make(map[string]bool)
+	}
+	if stars[session][id] {
+		delete(stars[session], id)
+		return false
+	}
+	stars[session][id] = true
+	return true
+}
+
+// unstarEverywhere prunes a deleted note from every session's favorites.
+func unstarEverywhere(id string) {
+	starsMu.Lock()
+	defer starsMu.Unlock()
+
+	for _, starred := range stars {
+		delete(starred, id)
+	}
+}
+
+// star handlers
+// -------------
+type StarResponse struct {
+	Starred bool `json:"starred"`
+}
+
+// toggleStar stars the note for the current session, or unstars it if it already was.
+func (s *ApiServer) toggleStar(w http.ResponseWriter, r *http.Request) error {
+	id := extractID(r.URL.Path)
+
+	session, err := ensureSession(w, r)
+	if err != nil {
+		return err
+	}
+
+	// hold mu so the note can't be deleted (and pruned) between the check and the star
+	mu.Lock()
+	_, exists := notes[id]
+	starred := exists && toggleStarred(session, id)
+	mu.Unlock()
+
+	if !exists {
+		if wantsJSON(r) {
+			return WriteJSON(r, w, http.StatusNotFound, ApiError{Error: "Note not found"})
+		}
+		return s.notFoundPage(w, "Note not found")
+	}
+
+	if wantsJSON(r) {
+		return WriteJSON(r, w, http.StatusOK, StarResponse{Starred: starred})
+	}
+
+	http.Redirect(w, r, "/notes/"+id, http.StatusFound)
+	return nil
+}
+
+// favoritesHandler lists the notes the current session has starred, newest first.
+func (s *ApiServer) favoritesHandler(w http.ResponseWriter, r *http.Request) error {
+	starred := starredNotes(readSession(r))
+	now := time.Now()
+
+	mu.Lock()
+	list := make([]Note, 0, len(starred))
+	for id := range starred {
+		if note, exists := notes[id]; exists && !note.expired(now) {
+			list = append(list, note)
+		}
+	}
+	mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Created.After(list[j].Created)
+	})
+
+	if wantsJSON(r) {
+		return WriteJSON(r, w, http.StatusOK, list)
+	}
+
+	return WriteHTML(w, http.StatusOK, templates, "list.html", ListPage{
+		baseTemplateData: s.baseData(),
+		Notes:            s.listItems(list),
+		Starred:          starred,
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// types
+// -----
+// Tx is the view of the notes a compound operation works against. Changes made through a
+// Tx are only applied if the whole operation succeeds.
+type Tx interface {
+	Get(id string) (Note, bool)
+	Put(note Note)
+	Delete(id string)
+	// Count is how many notes there would be if the Tx were applied now
+	Count() int
+}
+
+// NoteStore is where the notes live. Requests are served from the in-memory store;
+// fileStore keeps notes on disk, for backups.
+type NoteStore interface {
+	// WithTx runs fn against the notes, applying its changes only if it returns nil
+	WithTx(fn func(tx Tx) error) error
+	// Snapshot returns a deep copy of every note
+	Snapshot() []Note
+	// Ping reports whether the store can serve requests
+	Ping(ctx context.Context) error
+}
+
+// memStore is the in-memory note store: the notes map guarded by mu.
+type memStore struct{}
+
+var store NoteStore = memStore{}
+
+// Ping always succeeds, memory is never unreachable.
+func (memStore) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// errRollback can be returned from a WithTx func to discard its changes without it
+// being treated as a failure by the caller.
+var errRollback = errors.New("rolled back")
+
+// WithTx runs fn holding mu. Changes made through the Tx are staged and only applied
+// (through putNote and removeNote) if fn returns nil, otherwise they are all discarded.
+func (memStore) WithTx(fn func(tx Tx) error) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	tx := &memTx{notes: notes, staged: make(map[string]*Note)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	for _, id := range tx.order {
+		if note := tx.staged[id]; note != nil {
+			putNote(*note)
+		} else {
+			removeNote(id)
+		}
+	}
+	return nil
+}
+
+// Snapshot returns a deep copy of every note. Nothing in it is shared with the store,
+// so it can be read and marshalled after the lock is released.
+func (memStore) Snapshot() []Note {
+	mu.Lock()
+	defer mu.Unlock()
+
+	snapshot := make([]Note, 0, len(notes))
+	for _, note := range notes {
+		snapshot = append(snapshot, note.clone())
+	}
+	return snapshot
+}
+
+// clone returns a copy of the note that shares no slices or pointers with it.
+func (n Note) clone() Note {
+	if n.ExpiresAt != nil {
+		expiresAt := *n.ExpiresAt
+		n.ExpiresAt = &expiresAt
+	}
+	if n.Tags != nil {
+		n.Tags = append([]string(nil), n.Tags...)
+	}
+	return n
+}
+
+// snapshotter is a store whose snapshot can fail, like one read from a file. Snapshot can
+// only log the error, so a caller that must know asks for it here.
+type snapshotter interface {
+	snapshot() ([]Note, error)
+}
+
+// memTx stages changes on top of a map of notes, the notes map for memStore. A nil entry
+// in staged is a delete.
+type memTx struct {
+	notes  map[string]Note
+	staged map[string]*Note
+	order  []string
+}
+
+func (tx *memTx) Get(id string) (Note, bool) {
+	if note, ok := tx.staged[id]; ok {
+		if note == nil {
+			return Note{}, false
+		}
+		return *note, true
+	}
+	note, ok := tx.notes[id]
+	return note, ok
+}
+
+func (tx *memTx) Put(note Note) {
+	tx.stage(note.ID, &note)
+}
+
+func (tx *memTx) Delete(id string) {
+	tx.stage(id, nil)
+}
+
+func (tx *memTx) Count() int {
+	count := len(tx.notes)
+	for id, note := range tx.staged {
+		_, stored := tx.notes[id]
+		switch {
+		case note != nil && !stored:
+			count++
+		case note == nil && stored:
+			count--
+		}
+	}
+	return count
+}
+
+func (tx *memTx) stage(id string, note *Note) {
+	if _, ok := tx.staged[id]; !ok {
+		tx.order = append(tx.order, id)
+	}
+	tx.staged[id] = note
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSnapshotIsolated(t *testing.T) {
+	expires := time.Now().Add(time.Hour)
+	original := Note{ID: "1", Title: "Title", Content: "content", Tags: []string{"a", "b"}, ExpiresAt: &expires}
+
+	tests := []struct {
+		name   string
+		change func()
+	}{
+		{"update", func() {
+			storeTestNote(Note{ID: "1", Title: "Changed", Content: "changed", Tags: []string{"c"}})
+		}},
+		{"tags edited in place", func() {
+			mu.Lock()
+			notes["1"].Tags[0] = "changed"
+			mu.Unlock()
+		}},
+		{"delete", func() {
+			mu.Lock()
+			removeNote("1")
+			mu.Unlock()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestServer(t)
+			storeTestNote(original.clone())
+
+			snapshot := store.Snapshot()
+			tt.change()
+
+			if len(snapshot) != 1 {
+				t.Fatalf("snapshot has %d notes, want 1", len(snapshot))
+			}
+			got := snapshot[0]
+			if got.Title != "Title" || got.Content != "content" || got.Tags[0] != "a" || !got.ExpiresAt.Equal(expires) {
+				t.Errorf("snapshot note = %+v after the store changed, want %+v", got, original)
+			}
+		})
+	}
+}
+
+func TestSnapshotEditsStayOut(t *testing.T) {
+	newTestServer(t)
+	expires := time.Now().Add(time.Hour)
+	storeTestNote(Note{ID: "1", Title: "Title", Tags: []string{"a"}, ExpiresAt: &expires})
+
+	snapshot := store.Snapshot()
+	snapshot[0].Title = "changed"
+	snapshot[0].Tags[0] = "changed"
+	*snapshot[0].ExpiresAt = time.Time{}
+
+	got := notes["1"]
+	if got.Title != "Title" || got.Tags[0] != "a" || !got.ExpiresAt.Equal(expires) {
+		t.Errorf("store note = %+v after editing the snapshot", got)
+	}
+}
+
+func TestWithTxRollback(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"applied", nil, 2},
+		{"rolled back", errRollback, 0},
+		{"failed", errors.New("boom"), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestServer(t)
+			err := store.WithTx(func(tx Tx) error {
+				tx.Put(Note{ID: "1", Title: "one"})
+				tx.Put(Note{ID: "2", Title: "two"})
+				tx.Put(Note{ID: "3", Title: "three"})
+				tx.Delete("3")
+				if got := tx.Count(); got != 2 {
+					t.Errorf("Count = %d inside the tx, want 2", got)
+				}
+				return tt.err
+			})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("WithTx = %v, want %v", err, tt.err)
+			}
+			if len(notes) != tt.want {
+				t.Errorf("%d notes stored, want %d", len(notes), tt.want)
+			}
+		})
+	}
+}
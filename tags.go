@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTags splits a comma separated list of tags.
+func parseTags(list string) []string {
+	return cleanTags(strings.Split(list, ","))
+}
+
+// cleanTags trims each tag and drops the empty ones and any repeats. Tags that differ
+// only in case are repeats; the first spelling wins.
+func cleanTags(tags []string) []string {
+	cleaned := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		key := strings.ToLower(tag)
+		if tag == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		cleaned = append(cleaned, tag)
+	}
+	return cleaned
+}
+
+// WithMaxTags sets the most tags a note may have.
+func WithMaxTags(n int) ServerOption {
+	return func(s *ApiServer) {
+		s.maxTags = n
+	}
+}
+
+// WithMaxTagLength sets the most characters a single tag may have.
+func WithMaxTagLength(n int) ServerOption {
+	return func(s *ApiServer) {
+		s.maxTagLength = n
+	}
+}
+
+// WithDefaultTags tags new notes that come without tags of their own, e.g. with "inbox".
+// With always set, the defaults are added to every new note, tagged or not.
+func WithDefaultTags(tags []string, always bool) ServerOption {
+	return func(s *ApiServer) {
+		s.defaultTags = cleanTags(tags)
+		s.alwaysDefaultTags = always
+	}
+}
+
+// withDefaultTags returns a new note's tags with the configured defaults applied.
+func (s *ApiServer) withDefaultTags(tags []string) []string {
+	if len(tags) > 0 && !s.alwaysDefaultTags {
+		return tags
+	}
+	return cleanTags(append(append([]string(nil), tags...), s.defaultTags...))
+}
+
+// validateTags checks a cleaned tag list against the tag limits.
+func (s *ApiServer) validateTags(tags []string) error {
+	return s.tagErrors(tags).err()
+}
+
+// tagErrors returns every way tags break the tag limits, all under the tags field.
+func (s *ApiServer) tagErrors(tags []string) ValidationErrors {
+	var errs ValidationErrors
+	if len(tags) > s.maxTags {
+		errs = append(errs, ValidationError{Field: "tags", Message: fmt.Sprintf("too many tags: %d, the limit is %d", len(tags), s.maxTags)})
+	}
+	for _, tag := range tags {
+		if n := utf8.RuneCountInString(tag); n > s.maxTagLength {
+			errs = append(errs, ValidationError{Field: "tags", Message: fmt.Sprintf("tag %q is too long: %d characters, the limit is %d", tag, n, s.maxTagLength)})
+		}
+	}
+	return errs
+}
+
+// decodeTags reads a tag list from a JSON array, a form's tags field or a plain text
+// comma separated body.
+func (s *ApiServer) decodeTags(r *http.Request) ([]string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		var tags []string
+		if err := json.NewDecoder(r.Body).Decode(&tags); err != nil {
+			return nil, err
+		}
+		return cleanTags(tags), nil
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+		if err := s.parseForm(r); err != nil {
+			return nil, err
+		}
+		return parseTags(r.PostFormValue("tags")), nil
+	case "text/plain":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		return parseTags(string(body)), nil
+	default:
+		return nil, errUnsupportedMediaType
+	}
+}
+
+// tags handler
+// ------------
+// updateTags replaces a note's tags, leaving the title and content untouched.
+func (s *ApiServer) updateTags(w http.ResponseWriter, r *http.Request) error {
+	id := extractID(r.URL.Path)
+
+	tags, err := s.decodeTags(r)
+	if errors.Is(err, errUnsupportedMediaType) {
+		return s.noteError(w, r, http.StatusUnsupportedMediaType, err.Error())
+	}
+	if err != nil {
+		return s.noteError(w, r, http.StatusBadRequest, "Error parsing tags: "+err.Error())
+	}
+	if err := s.validateTags(tags); err != nil {
+		return s.invalidNote(w, r, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	note, exists := notes[id]
+	if !exists {
+		return s.noteError(w, r, http.StatusNotFound, "Note not found")
+	}
+
+	if note.Locked {
+		return s.noteError(w, r, http.StatusForbidden, errReadOnly)
+	}
+	if lock, held := s.activeLock(id); held && lock.Token != lockToken(r) {
+		return s.noteError(w, r, http.StatusLocked, "Note is locked by another editor")
+	}
+
+	note.Tags = tags
+	note = putNote(note)
+
+	if wantsJSON(r) {
+		return WriteJSON(r, w, http.StatusOK, note)
+	}
+
+	http.Redirect(w, r, "/notes/"+id, http.StatusFound)
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCleanTags(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []string
+		want []string
+	}{
+		{"none", nil, []string{}},
+		{"trims", []string{" a ", "b\t"}, []string{"a", "b"}},
+		{"drops empty", []string{"", "  ", "a"}, []string{"a"}},
+		{"drops repeats", []string{"a", "b", "a"}, []string{"a", "b"}},
+		{"repeats ignore case, first spelling wins", []string{"Work", "work", "WORK"}, []string{"Work"}},
+		{"repeats after trimming", []string{"a", " a"}, []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cleanTags(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cleanTags(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	s := NewHTMLServer(":0", WithMaxTags(3), WithMaxTagLength(5))
+
+	tests := []struct {
+		name string
+		tags []string
+		want int // how many errors
+	}{
+		{"none", nil, 0},
+		{"at the limits", []string{"a", "bb", "ccccc"}, 0},
+		{"too many", []string{"a", "b", "c", "d"}, 1},
+		{"too long", []string{"toolong"}, 1},
+		{"length counts characters", []string{"ééééé"}, 0},
+		{"too many and two too long", []string{"a", "b", "toolong", "waytoolong"}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := s.tagErrors(tt.tags)
+			if len(errs) != tt.want {
+				t.Fatalf("tagErrors(%q) = %v, want %d errors", tt.tags, errs, tt.want)
+			}
+			for _, err := range errs {
+				if err.Field != "tags" {
+					t.Errorf("error on field %q, want tags", err.Field)
+				}
+			}
+			if (s.validateTags(tt.tags) == nil) != (tt.want == 0) {
+				t.Errorf("validateTags(%q) = %v", tt.tags, s.validateTags(tt.tags))
+			}
+		})
+	}
+}
+
+func TestUpdateTags(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        int
+		wantTags    []string
+	}{
+		{"json", "application/json", `["a", "A", " b "]`, http.StatusOK, []string{"a", "b"}},
+		{"form", "application/x-www-form-urlencoded", "tags=a,b,a", http.StatusOK, []string{"a", "b"}},
+		{"plain text", "text/plain", "x, y", http.StatusOK, []string{"x", "y"}},
+		{"duplicates don't count toward the limit", "application/json", `["a", "a", "b", "b", "c", "c"]`, http.StatusOK, []string{"a", "b", "c"}},
+		{"too many", "application/json", `["a", "b", "c", "d"]`, http.StatusBadRequest, []string{"old"}},
+		{"too long", "application/json", `["toolong"]`, http.StatusBadRequest, []string{"old"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t, WithMaxTags(3), WithMaxTagLength(5))
+			storeTestNote(Note{ID: "1", Title: "Note", Tags: []string{"old"}})
+
+			w := serve(h, "PUT", "/notes/1/tags", tt.body, "Content-Type", tt.contentType, "Accept", "application/json")
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if got := notes["1"].Tags; !reflect.DeepEqual(got, tt.wantTags) {
+				t.Errorf("tags = %q, want %q", got, tt.wantTags)
+			}
+			if tt.want == http.StatusBadRequest {
+				var body ValidationErrorResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || len(body.Errors) == 0 || body.Errors[0].Field != "tags" {
+					t.Errorf("body = %s, want errors on the tags field", w.Body)
+				}
+			}
+			if strings.Contains(w.Body.String(), "<html") {
+				t.Errorf("an API client got HTML: %s", w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+)
+
+type TimelinePage struct {
+	baseTemplateData
+	Days []TimelineDay
+}
+
+// TimelineDay is the notes created on one calendar day, newest first.
+type TimelineDay struct {
+	// Label is "Today", "Yesterday" or the date
+	Label string    `json:"label"`
+	Date  time.Time `json:"date"`
+	Notes []Note    `json:"notes"`
+}
+
+// timelineHandler lists the notes grouped by the day they were created, newest day first.
+// Days are calendar days in the server's time zone unless ?tz= names another one. Days
+// without notes are left out rather than shown empty.
+func (s *ApiServer) timelineHandler(w http.ResponseWriter, r *http.Request) error {
+	loc, err := requestLocation(r)
+	if err != nil {
+		if wantsJSON(r) {
+			return WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: err.Error()})
+		}
+		return WriteHTML(w, http.StatusBadRequest, templates, "error.html", s.errorPage(err.Error()))
+	}
+
+	now := time.Now()
+	list := make([]Note, 0)
+	for _, note := range store.Snapshot() {
+		if !note.expired(now) && !note.IsTemplate {
+			list = append(list, note)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Created.After(list[j].Created)
+	})
+
+	days := groupByDay(list, now, loc)
+
+	if wantsJSON(r) {
+		return WriteJSON(r, w, http.StatusOK, days)
+	}
+
+	return WriteHTML(w, http.StatusOK, templates, "timeline.html", TimelinePage{
+		baseTemplateData: s.baseData(),
+		Days:             days,
+	})
+}
+
+// groupByDay splits notes, which must be sorted newest first, into one TimelineDay per
+// calendar day in loc. Days are labelled relative to now.
+func groupByDay(list []Note, now time.Time, loc *time.Location) []TimelineDay {
+	today, _ := dayBounds(now, loc)
+	yesterday, _ := dayBounds(today.AddDate(0, 0, -1), loc)
+
+	days := make([]TimelineDay, 0)
+	for _, note := range list {
+		// shown in loc too, so the times match the day they are grouped under
+		note.Created = note.Created.In(loc)
+		start, _ := dayBounds(note.Created, loc)
+		if n := len(days); n == 0 || !days[n-1].Date.Equal(start) {
+			days = append(days, TimelineDay{Label: dayLabel(start, today, yesterday), Date: start})
+		}
+		days[len(days)-1].Notes = append(days[len(days)-1].Notes, note)
+	}
+	return days
+}
+
+func dayLabel(day, today, yesterday time.Time) string {
+	switch {
+	case day.Equal(today):
+		return "Today"
+	case day.Equal(yesterday):
+		return "Yesterday"
+	default:
+		return day.Format("Monday, 2 January 2006")
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// types
+// -----
+type titleEntry struct {
+	key string // the title as key turns it into
+	id  string
+}
+
+// titleIndex keeps every note's title sorted so prefix lookups are a binary search instead
+// of a scan over all notes. It is kept in sync by putNote and removeNote, under mu.
+type titleIndex struct {
+	entries []titleEntry
+
+	// key turns a title, or a prefix looked up, into what is compared
+	key func(string) string
+}
+
+var (
+	titles = &titleIndex{key: titleKey}
+
+	// foldedTitles is the same index with accents stripped, for WithSearchNormalization
+	foldedTitles = &titleIndex{key: normalizeForSearch}
+)
+
+func titleKey(title string) string {
+	return strings.ToLower(title)
+}
+
+// search returns the position of the first entry not before (key, id).
+func (idx *titleIndex) search(key, id string) int {
+	return sort.Search(len(idx.entries), func(i int) bool {
+		e := idx.entries[i]
+		return e.key > key || (e.key == key && e.id >= id)
+	})
+}
+
+func (idx *titleIndex) add(title, id string) {
+	key := idx.key(title)
+	i := idx.search(key, id)
+	idx.entries = append(idx.entries, titleEntry{})
+	copy(idx.entries[i+1:], idx.entries[i:])
+	idx.entries[i] = titleEntry{key: key, id: id}
+}
+
+func (idx *titleIndex) remove(title, id string) {
+	key := idx.key(title)
+	i := idx.search(key, id)
+	if i < len(idx.entries) && idx.entries[i] == (titleEntry{key: key, id: id}) {
+		idx.entries = append(idx.entries[:i], idx.entries[i+1:]...)
+	}
+}
+
+// prefix returns the ids of notes whose title starts with prefix, compared by key, in
+// title order. A limit of 0 or less means no limit.
+func (idx *titleIndex) prefix(prefix string, limit int) []string {
+	key := idx.key(prefix)
+	var ids []string
+	for i := idx.search(key, ""); i < len(idx.entries) && strings.HasPrefix(idx.entries[i].key, key); i++ {
+		if limit > 0 && len(ids) == limit {
+			break
+		}
+		ids = append(ids, idx.entries[i].id)
+	}
+	return ids
+}
+
+// suggest handler
+// ---------------
+type Suggestion struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// suggestHandler returns notes whose title starts with ?q=, for autocomplete. Case is
+// ignored, and so are accents with WithSearchNormalization.
+func (s *ApiServer) suggestHandler(w http.ResponseWriter, r *http.Request) error {
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		return WriteJSON(r, w, http.StatusOK, []Suggestion{})
+	}
+
+	limit := 10
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 && n <= 100 {
+		limit = n
+	}
+
+	now := time.Now()
+	suggestions := []Suggestion{}
+
+	index := titles
+	if s.normalizeSearch {
+		index = foldedTitles
+	}
+
+	mu.Lock()
+	// ask for everything matching, expired notes and templates are skipped below
+	for _, id := range index.prefix(q, 0) {
+		if len(suggestions) == limit {
+			break
+		}
+		if note := notes[id]; !note.expired(now) && !note.IsTemplate {
+			suggestions = append(suggestions, Suggestion{ID: note.ID, Title: note.Title})
+		}
+	}
+	mu.Unlock()
+
+	return WriteJSON(r, w, http.StatusOK, suggestions)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTitleIndexPrefix(t *testing.T) {
+	idx := &titleIndex{key: titleKey}
+	for id, title := range map[string]string{"1": "Groceries", "2": "grocery list", "3": "Garden", "4": "Gro", "5": "Removed"} {
+		idx.add(title, id)
+	}
+	idx.remove("Removed", "5")
+	// removing what isn't there changes nothing
+	idx.remove("Garden", "99")
+
+	tests := []struct {
+		prefix string
+		limit  int
+		want   []string
+	}{
+		{"gro", 0, []string{"4", "1", "2"}},
+		{"GROC", 0, []string{"1", "2"}},
+		{"gro", 2, []string{"4", "1"}},
+		{"g", 0, []string{"3", "4", "1", "2"}},
+		{"", 0, []string{"3", "4", "1", "2"}},
+		{"rem", 0, nil},
+		{"groceries and more", 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%q limit %d", tt.prefix, tt.limit), func(t *testing.T) {
+			if got := idx.prefix(tt.prefix, tt.limit); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("prefix = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTitleIndexFolded(t *testing.T) {
+	idx := &titleIndex{key: normalizeForSearch}
+	idx.add("Café menu", "1")
+	idx.add("Cafeteria", "2")
+
+	if got, want := idx.prefix("CAFE", 0), []string{"1", "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("prefix = %v, want %v", got, want)
+	}
+}
+
+// BenchmarkTitlePrefix compares a prefix lookup in the index with the scan over every
+// note it replaces.
+func BenchmarkTitlePrefix(b *testing.B) {
+	const n = 10_000
+	idx := &titleIndex{key: titleKey}
+	all := make(map[string]Note, n)
+	for i := 0; i < n; i++ {
+		note := Note{ID: fmt.Sprint(i), Title: fmt.Sprintf("Note %05d about things", i)}
+		all[note.ID] = note
+		idx.add(note.Title, note.ID)
+	}
+	const prefix = "note 0420"
+
+	b.Run("indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if ids := idx.prefix(prefix, 10); len(ids) != 10 {
+				b.Fatalf("%d matches, want 10", len(ids))
+			}
+		}
+	})
+	b.Run("linear", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var ids []string
+			for id, note := range all {
+				if strings.HasPrefix(strings.ToLower(note.Title), prefix) {
+					ids = append(ids, id)
+				}
+			}
+			if len(ids) != 10 {
+				b.Fatalf("%d matches, want 10", len(ids))
+			}
+		}
+	})
+}
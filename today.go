@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+	_ "time/tzdata" // so ?tz= works on hosts without a zoneinfo database
+)
+
+// todayHandler lists the notes, templates aside, created during the current calendar
+// day, newest first. The day is the server's unless ?tz= names an IANA time zone, e.g.
+// ?tz=Europe/Vienna.
+func (s *ApiServer) todayHandler(w http.ResponseWriter, r *http.Request) error {
+	loc, err := requestLocation(r)
+	if err != nil {
+		if wantsJSON(r) {
+			return WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: err.Error()})
+		}
+		return WriteHTML(w, http.StatusBadRequest, templates, "error.html", s.errorPage(err.Error()))
+	}
+
+	now := time.Now()
+	start, end := dayBounds(now, loc)
+
+	mu.Lock()
+	list := make([]Note, 0)
+	for _, note := range notes {
+		if !note.expired(now) && !note.IsTemplate && !note.Created.Before(start) && note.Created.Before(end) {
+			list = append(list, note)
+		}
+	}
+	mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Created.After(list[j].Created)
+	})
+
+	if wantsJSON(r) {
+		return WriteJSON(r, w, http.StatusOK, list)
+	}
+
+	return WriteHTML(w, http.StatusOK, templates, "list.html", ListPage{
+		baseTemplateData: s.baseData(),
+		Notes:            s.listItems(list),
+		Starred:          starredNotes(readSession(r)),
+	})
+}
+
+// requestLocation returns the time zone named by ?tz=, or the server's if there is none.
+func requestLocation(r *http.Request) (*time.Location, error) {
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone: %s", tz)
+	}
+	return loc, nil
+}
+
+// dayBounds returns the start of t's calendar day in loc and the start of the next one.
+// The next day comes from the calendar rather than adding 24h, so days that are 23 or 25
+// hours long around a DST change still end at midnight.
+func dayBounds(t time.Time, loc *time.Location) (start, end time.Time) {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc), time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithTracerProvider traces every request with spans from tp. Without one, tracing is
+// off and the middleware isn't installed at all.
+//
+// To export the spans, build a provider with an exporter and pass it in, e.g. for OTLP:
+//
+//	exporter, _ := otlptracegrpc.New(ctx)
+//	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+//	defer tp.Shutdown(ctx)
+//	server := NewHTMLServer(":8080", WithTracerProvider(tp))
+//
+// The -tracing flag uses the global provider from otel.GetTracerProvider instead, which
+// only records anything once the program registers one with otel.SetTracerProvider.
+func WithTracerProvider(tp trace.TracerProvider) ServerOption {
+	return func(s *ApiServer) {
+		s.tracerProvider = tp
+	}
+}
+
+// withTracing starts a server span per request, continuing the caller's trace when the
+// request carries a traceparent header. The span is named after the mux route the request
+// matched and records the method and response status. Handlers can add child spans with
+// trace.SpanFromContext(r.Context()).
+func (s *ApiServer) withTracing(mux *http.ServeMux, next http.Handler) http.Handler {
+	if s.tracerProvider == nil {
+		return next
+	}
+
+	tracer := s.tracerProvider.Tracer("github.com/cgradwohl/go-html-server")
+	propagator := propagation.TraceContext{}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+		if rec.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
+
+// globalTracerProvider is the provider the -tracing flag uses.
+func globalTracerProvider(enabled bool) trace.TracerProvider {
+	if !enabled {
+		return nil
+	}
+	return otel.GetTracerProvider()
+}
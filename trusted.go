@@ -0,0 +1,48 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+)
+
+// trustedContent returns a note's content marked safe for html/template, so it renders
+// as HTML instead of being escaped. Only notes an admin has marked Trusted get this:
+// trusted content can run scripts in every visitor's browser (XSS), so an admin must
+// vouch for it, and any edit that isn't the admin's own trust call clears the flag.
+func trustedContent(note Note) template.HTML {
+	if !note.Trusted {
+		return ""
+	}
+	return template.HTML(note.Content)
+}
+
+// trust handler
+// -------------
+// trustNote sets or clears a note's Trusted flag from the trusted form or query value.
+// It is admin only.
+func (s *ApiServer) trustNote(w http.ResponseWriter, r *http.Request) error {
+	if !s.isAdmin(r) {
+		return s.adminDenied(w, r)
+	}
+
+	trusted, err := strconv.ParseBool(r.FormValue("trusted"))
+	if err != nil {
+		return WriteJSON(r, w, http.StatusBadRequest, ApiError{Error: "trusted must be true or false"})
+	}
+
+	id := extractID(r.URL.Path)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	note, exists := notes[id]
+	if !exists {
+		return WriteJSON(r, w, http.StatusNotFound, ApiError{Error: "Note not found"})
+	}
+
+	note.Trusted = trusted
+	note = putNote(note)
+
+	return WriteJSON(r, w, http.StatusOK, note)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ValidationError is a problem with one field of a note.
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors is every problem found with a note. Its Error joins the messages, for
+// pages and logs.
+type ValidationErrors []ValidationError
+
+func (errs ValidationErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, e := range errs {
+		messages[i] = e.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// err returns errs as an error, or nil if there are none. Returning an empty
+// ValidationErrors as an error would make it non-nil.
+func (errs ValidationErrors) err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// ValidationErrorResponse is the JSON body of a 400 for an invalid note.
+type ValidationErrorResponse struct {
+	Errors ValidationErrors `json:"errors"`
+}
+
+// validationBody returns the JSON body for err: the field by field errors if it is a
+// ValidationErrors, a plain ApiError otherwise.
+func validationBody(err error) any {
+	var errs ValidationErrors
+	if errors.As(err, &errs) {
+		return ValidationErrorResponse{Errors: errs}
+	}
+	return ApiError{Error: err.Error()}
+}
+
+// invalidNote answers a request whose note failed validation with a 400: the errors field
+// by field for API clients, the error page with all of them for browsers.
+func (s *ApiServer) invalidNote(w http.ResponseWriter, r *http.Request, err error) error {
+	if wantsJSON(r) {
+		return WriteJSON(r, w, http.StatusBadRequest, validationBody(err))
+	}
+	return WriteHTML(w, http.StatusBadRequest, templates, "error.html", s.errorPage(err.Error()))
+}
+
+// noteError answers a request about a note with an error status and message: as an
+// ApiError for API clients, the error page, or the not-found page for a 404, for browsers.
+func (s *ApiServer) noteError(w http.ResponseWriter, r *http.Request, code int, message string) error {
+	if wantsJSON(r) {
+		return WriteJSON(r, w, code, ApiError{Error: message})
+	}
+	if code == http.StatusNotFound {
+		return s.notFoundPage(w, message)
+	}
+	return WriteHTML(w, code, templates, "error.html", s.errorPage(message))
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateNoteValidationErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want ValidationErrors
+	}{
+		{"missing title", `{"title": " ", "content": "x"}`, ValidationErrors{
+			{Field: "title", Message: "title is required"},
+		}},
+		{"every problem", `{"title": "", "content": "` + strings.Repeat("a", 11) + `", "css_class": "1bad"}`, ValidationErrors{
+			{Field: "title", Message: "title is required"},
+			{Field: "content", Message: "content is too long: 11 characters, the limit is 10"},
+			{Field: "css_class", Message: "css class must be a letter followed by letters, digits and dashes, at most 64 characters"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t, WithMaxContentLength(10))
+			w := serve(h, "POST", "/notes", tt.body, "Content-Type", "application/json", "Accept", "application/json")
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+			}
+			var got ValidationErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("invalid JSON: %v: %s", err, w.Body)
+			}
+			if !reflect.DeepEqual(got.Errors, tt.want) {
+				t.Errorf("errors = %+v, want %+v", got.Errors, tt.want)
+			}
+		})
+	}
+}
+
+func TestNoteErrorResponses(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		body    string
+		headers []string
+		// locked and editLock set up the note the request is about
+		locked   bool
+		editLock bool
+		want     int
+	}{
+		{"update missing", "PUT", "/notes/99", `{"title": "t"}`, nil, false, false, http.StatusNotFound},
+		{"update read-only", "PUT", "/notes/1", `{"title": "t"}`, nil, true, false, http.StatusForbidden},
+		{"update stale", "PUT", "/notes/1", `{"title": "t"}`, []string{"If-Match", `"stale"`}, false, false, http.StatusPreconditionFailed},
+		{"update unsupported type", "PUT", "/notes/1", "title,content", []string{"Content-Type", "text/csv"}, false, false, http.StatusUnsupportedMediaType},
+		{"update locked by another editor", "PUT", "/notes/1", `{"title": "t"}`, nil, false, true, http.StatusLocked},
+		{"delete missing", "DELETE", "/notes/99", "", nil, false, false, http.StatusNotFound},
+		{"delete read-only", "DELETE", "/notes/1", "", nil, true, false, http.StatusForbidden},
+		{"tags missing", "PUT", "/notes/99/tags", `["a"]`, nil, false, false, http.StatusNotFound},
+		{"tags read-only", "PUT", "/notes/1/tags", `["a"]`, nil, true, false, http.StatusForbidden},
+		{"tags unsupported type", "PUT", "/notes/1/tags", "a", []string{"Content-Type", "text/csv"}, false, false, http.StatusUnsupportedMediaType},
+		{"tags locked by another editor", "PUT", "/notes/1/tags", `["a"]`, nil, false, true, http.StatusLocked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t)
+			storeTestNote(Note{ID: "1", Title: "Note", Content: "x", Created: time.Now(), Locked: tt.locked})
+			if tt.editLock {
+				mu.Lock()
+				editLocks["1"] = editLock{Token: "someone-else", Acquired: time.Now()}
+				mu.Unlock()
+			}
+
+			headers := append([]string{"Content-Type", "application/json", "Accept", "application/json"}, tt.headers...)
+			w := serve(h, tt.method, tt.target, tt.body, headers...)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			var got ApiError
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || got.Error == "" {
+				t.Errorf("body isn't an ApiError: %v: %s", err, w.Body)
+			}
+
+			// browsers get a page instead
+			headers[3] = "text/html"
+			w = serve(h, tt.method, tt.target, tt.body, headers...)
+			if w.Code != tt.want || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+				t.Errorf("browser got %d %q, want %d text/html", w.Code, w.Header().Get("Content-Type"), tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateNoteErrorResponses(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []ServerOption
+		target      string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"malformed json", nil, "/notes", "application/json", `{"title": `, http.StatusBadRequest},
+		{"oversized", []ServerOption{WithMaxContentLength(10)}, "/notes", "application/json", `{"title": "t", "content": "` + strings.Repeat("a", 70<<10) + `"}`, http.StatusRequestEntityTooLarge},
+		{"unsupported type", nil, "/notes", "text/csv", "title,content", http.StatusUnsupportedMediaType},
+		{"missing template", nil, "/notes?from_template=99", "application/json", `{"title": "t"}`, http.StatusNotFound},
+		{"at the note limit", []ServerOption{WithMaxTotalNotes(1)}, "/notes", "application/json", `{"title": "t"}`, http.StatusInsufficientStorage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t, tt.opts...)
+			storeTestNote(Note{ID: "1", Title: "Note", Content: "x", Created: time.Now()})
+
+			w := serve(h, "POST", tt.target, tt.body, "Content-Type", tt.contentType, "Accept", "application/json")
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %.200s", w.Code, tt.want, w.Body)
+			}
+			var got ApiError
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || got.Error == "" {
+				t.Errorf("body isn't an ApiError: %v: %.200s", err, w.Body)
+			}
+
+			// browsers get a page instead
+			w = serve(h, "POST", tt.target, tt.body, "Content-Type", tt.contentType, "Accept", "text/html")
+			if w.Code != tt.want || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+				t.Errorf("browser got %d %q, want %d text/html", w.Code, w.Header().Get("Content-Type"), tt.want)
+			}
+		})
+	}
+}
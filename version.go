@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// build info, set at link time, e.g.
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%FT%TZ)"
+//
+// The Makefile's build target does this.
+var (
+	version   = "dev"
+	commit    = ""
+	buildTime = ""
+)
+
+type VersionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// versionInfo returns the build info. A commit or build time that wasn't set at link
+// time falls back to what the go command recorded from version control, if anything.
+func versionInfo() VersionInfo {
+	info := VersionInfo{Version: version, Commit: commit, BuildTime: buildTime, GoVersion: runtime.Version()}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildTime == "":
+				info.BuildTime = setting.Value
+			}
+		}
+	}
+	return info
+}
+
+// versionHandler reports which build is running, as JSON for clients that accept it and
+// as plain text otherwise.
+func (s *ApiServer) versionHandler(w http.ResponseWriter, r *http.Request) error {
+	info := versionInfo()
+	if wantsJSON(r) {
+		return WriteJSON(r, w, http.StatusOK, info)
+	}
+
+	body := fmt.Sprintf("version: %s\ncommit: %s\nbuild time: %s\ngo: %s\n", info.Version, info.Commit, info.BuildTime, info.GoVersion)
+	return WriteBytes(w, http.StatusOK, "text/plain; charset=utf-8", []byte(body))
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+)
+
+// view counts keyed by note ID, guarded by mu. They live apart from the notes so that
+// counting a view doesn't record a revision, change the ETag or invalidate the list cache.
+var noteViews = make(map[string]int)
+
+// WithCountViews turns view counting on or off. Counting takes the write lock on every
+// page view, so busy read-mostly instances may want it off.
+func WithCountViews(count bool) ServerOption {
+	return func(s *ApiServer) {
+		s.countViews = count
+	}
+}
+
+// countView records a page view of a note and returns its view count. Only GETs count,
+// so HEAD requests from monitoring don't inflate it.
+func (s *ApiServer) countView(r *http.Request, id string) int {
+	mu.Lock()
+	defer mu.Unlock()
+
+	// the note may have been deleted since the caller read it
+	if _, exists := notes[id]; exists && s.countViews && r.Method == "GET" {
+		noteViews[id]++
+	}
+	return noteViews[id]
+}
+
+// sortByViews orders notes most viewed first, keeping the existing order among ties.
+// The caller must hold mu.
+func sortByViews(list []Note) {
+	sort.SliceStable(list, func(i, j int) bool {
+		return noteViews[list[i].ID] > noteViews[list[j].ID]
+	})
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// webhookAttempts is how many times a webhook delivery is tried before it is given up.
+const webhookAttempts = 3
+
+// WithCreateWebhook POSTs the JSON of every note created through POST /notes to url,
+// e.g. to sync notes to another system. Each attempt times out after timeout. An empty
+// url turns the webhook off.
+func WithCreateWebhook(url string, timeout time.Duration) ServerOption {
+	return func(s *ApiServer) {
+		s.createWebhook = url
+		s.webhookClient = &http.Client{Timeout: timeout}
+	}
+}
+
+// WithWebhookSecret signs every webhook body with HMAC-SHA256 under secret, sent as
+// "sha256=<hex>" in the X-Webhook-Signature-256 header, so receivers can check the
+// call came from this server and the body wasn't changed. An empty secret sends no
+// signature.
+func WithWebhookSecret(secret string) ServerOption {
+	return func(s *ApiServer) {
+		s.webhookSecret = secret
+	}
+}
+
+// WithWebhookQuietHours suppresses the create webhook between the times of day start and
+// end in loc, e.g. 22h and 7h for nights. Notes are still created, they are just not sent.
+// The window may wrap past midnight. Equal times, the default, mean no quiet hours.
+func WithWebhookQuietHours(start, end time.Duration, loc *time.Location) ServerOption {
+	return func(s *ApiServer) {
+		s.webhookQuietStart = start
+		s.webhookQuietEnd = end
+		s.webhookQuietLoc = loc
+	}
+}
+
+// inQuietHours reports whether t falls in the webhook's quiet hours.
+func (s *ApiServer) inQuietHours(t time.Time) bool {
+	if s.webhookQuietStart == s.webhookQuietEnd {
+		return false
+	}
+
+	// the wall clock, so the window doesn't shift on days with a DST change
+	h, m, sec := t.In(s.webhookQuietLoc).Clock()
+	now := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second
+	if s.webhookQuietStart < s.webhookQuietEnd {
+		return now >= s.webhookQuietStart && now < s.webhookQuietEnd
+	}
+	return now >= s.webhookQuietStart || now < s.webhookQuietEnd
+}
+
+// parseQuietHours parses a window of the day such as "22:00-07:00".
+func parseQuietHours(window string) (start, end time.Duration, err error) {
+	if window == "" {
+		return 0, 0, nil
+	}
+	from, to, ok := strings.Cut(window, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid quiet hours %q, use HH:MM-HH:MM", window)
+	}
+	if start, err = parseTimeOfDay(from); err == nil {
+		end, err = parseTimeOfDay(to)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid quiet hours %q, use HH:MM-HH:MM", window)
+	}
+	return start, end, nil
+}
+
+// parseTimeOfDay parses "HH:MM" as the time since midnight.
+func parseTimeOfDay(clock string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// notifyCreated sends the note r created to the create webhook without holding up the
+// response. Delivery is best effort: failures are retried a few times, then logged.
+// Nothing is sent during quiet hours.
+func (s *ApiServer) notifyCreated(r *http.Request, note Note) {
+	if s.createWebhook == "" || s.inQuietHours(time.Now()) {
+		return
+	}
+
+	// read now, the request is done with by the time the webhook is sent
+	id := requestID(r)
+	go func() {
+		if err := s.deliverWebhook(note, id); err != nil {
+			log.Printf("WARN create webhook for note %s: %v", note.ID, err)
+		}
+	}()
+}
+
+// deliverWebhook POSTs the note until the webhook answers with a 2xx, backing off a
+// little longer after each failed attempt. Every attempt carries the id of the request
+// that created the note, so the receiver can correlate it with this server's logs.
+func (s *ApiServer) deliverWebhook(note Note, requestID string) error {
+	body, err := json.Marshal(note)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = s.postWebhook(body, requestID)
+		if err == nil || attempt == webhookAttempts {
+			return err
+		}
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+}
+
+func (s *ApiServer) postWebhook(body []byte, requestID string) error {
+	req, err := http.NewRequest("POST", s.createWebhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if requestID != "" {
+		req.Header.Set(requestIDHeader, requestID)
+	}
+	if s.webhookSecret != "" {
+		req.Header.Set("X-Webhook-Signature-256", "sha256="+signWebhook(s.webhookSecret, body))
+	}
+
+	resp, err := s.webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// signWebhook returns the hex HMAC-SHA256 of body under secret. A receiver recomputes it
+// over the raw body and compares the two with hmac.Equal.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// webhookCall is a request a test webhook received.
+type webhookCall struct {
+	header http.Header
+	body   []byte
+}
+
+// newWebhook starts a webhook receiver that answers the first failures attempts with a
+// 500, and sends every call it gets on the returned channel.
+func newWebhook(t *testing.T, failures int) (*httptest.Server, <-chan webhookCall) {
+	t.Helper()
+	calls := make(chan webhookCall, webhookAttempts)
+	var attempts atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		calls <- webhookCall{header: r.Header.Clone(), body: body}
+		if attempts.Add(1) <= int64(failures) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, calls
+}
+
+// receive waits for the next webhook call.
+func receive(t *testing.T, calls <-chan webhookCall) webhookCall {
+	t.Helper()
+	select {
+	case call := <-calls:
+		return call
+	case <-time.After(5 * time.Second):
+		t.Fatal("the webhook was not called")
+		return webhookCall{}
+	}
+}
+
+func TestCreateWebhook(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		attempts int
+	}{
+		{"delivered", 0, 1},
+		{"retried after a failure", 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook, calls := newWebhook(t, tt.failures)
+			_, h := newTestServer(t, WithCreateWebhook(hook.URL, time.Second))
+
+			w := serve(h, "POST", "/notes", "title=Hooked&content=body", "Content-Type", "application/x-www-form-urlencoded")
+			if w.Code != http.StatusFound {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+			}
+
+			var call webhookCall
+			for i := 0; i < tt.attempts; i++ {
+				call = receive(t, calls)
+			}
+			var note Note
+			if err := json.Unmarshal(call.body, &note); err != nil {
+				t.Fatalf("webhook body isn't a note: %v: %s", err, call.body)
+			}
+			if note.ID != w.Header().Get("X-Note-ID") || note.Title != "Hooked" || note.Content != "body" {
+				t.Errorf("webhook got %+v, want the created note", note)
+			}
+			if got := call.header.Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+		})
+	}
+}
+
+func TestWebhookHeaders(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		requestID string
+	}{
+		{"signed, with the client's request id", "s3cret", "client-req-42"},
+		{"unsigned", "", "client-req-42"},
+		{"generated request id", "s3cret", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook, calls := newWebhook(t, 0)
+			_, h := newTestServer(t, WithCreateWebhook(hook.URL, time.Second), WithWebhookSecret(tt.secret))
+
+			headers := []string{"Content-Type", "application/x-www-form-urlencoded"}
+			if tt.requestID != "" {
+				headers = append(headers, requestIDHeader, tt.requestID)
+			}
+			w := serve(h, "POST", "/notes", "title=Signed&content=body", headers...)
+			call := receive(t, calls)
+
+			// the webhook carries the id the response did, whether sent or generated
+			want := w.Header().Get(requestIDHeader)
+			if got := call.header.Get(requestIDHeader); got == "" || got != want {
+				t.Errorf("%s = %q, want %q", requestIDHeader, got, want)
+			}
+			if tt.requestID != "" && want != tt.requestID {
+				t.Errorf("request id %q wasn't kept, got %q", tt.requestID, want)
+			}
+
+			signature := call.header.Get("X-Webhook-Signature-256")
+			if tt.secret == "" {
+				if signature != "" {
+					t.Errorf("unsigned webhook has signature %q", signature)
+				}
+				return
+			}
+			mac := hmac.New(sha256.New, []byte(tt.secret))
+			mac.Write(call.body)
+			if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); !hmac.Equal([]byte(signature), []byte(want)) {
+				t.Errorf("signature = %q, want %q", signature, want)
+			}
+		})
+	}
+}
+
+func TestCreateWebhookQuietHours(t *testing.T) {
+	hook, calls := newWebhook(t, 0)
+	// quiet all day but the last minute before midnight, so the test never lands outside
+	_, h := newTestServer(t, WithCreateWebhook(hook.URL, time.Second), WithWebhookQuietHours(0, 24*time.Hour-time.Minute, time.UTC))
+	if time.Now().UTC().Hour() == 23 && time.Now().UTC().Minute() == 59 {
+		t.Skip("outside the quiet hours")
+	}
+
+	serve(h, "POST", "/notes", "title=Quiet&content=body", "Content-Type", "application/x-www-form-urlencoded")
+	select {
+	case call := <-calls:
+		t.Errorf("webhook called during quiet hours with %s", call.body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestInQuietHours(t *testing.T) {
+	at := func(h, m int) time.Time { return time.Date(2024, 3, 1, h, m, 0, 0, time.UTC) }
+	tests := []struct {
+		name       string
+		start, end time.Duration
+		t          time.Time
+		want       bool
+	}{
+		{"no window", 0, 0, at(3, 0), false},
+		{"inside a day window", 9 * time.Hour, 17 * time.Hour, at(12, 0), true},
+		{"at its start", 9 * time.Hour, 17 * time.Hour, at(9, 0), true},
+		{"at its end", 9 * time.Hour, 17 * time.Hour, at(17, 0), false},
+		{"outside a day window", 9 * time.Hour, 17 * time.Hour, at(18, 0), false},
+		{"late in a night window", 22 * time.Hour, 7 * time.Hour, at(23, 30), true},
+		{"early in a night window", 22 * time.Hour, 7 * time.Hour, at(6, 59), true},
+		{"outside a night window", 22 * time.Hour, 7 * time.Hour, at(12, 0), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewHTMLServer(":0", WithWebhookQuietHours(tt.start, tt.end, time.UTC))
+			if got := s.inQuietHours(tt.t); got != tt.want {
+				t.Errorf("inQuietHours(%s) = %v, want %v", tt.t.Format("15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQuietHours(t *testing.T) {
+	tests := []struct {
+		window     string
+		start, end time.Duration
+		wantErr    bool
+	}{
+		{"", 0, 0, false},
+		{"22:00-07:00", 22 * time.Hour, 7 * time.Hour, false},
+		{"09:30-17:15", 9*time.Hour + 30*time.Minute, 17*time.Hour + 15*time.Minute, false},
+		{"22:00", 0, 0, true},
+		{"late-early", 0, 0, true},
+		{"25:00-07:00", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.window, func(t *testing.T) {
+			start, end, err := parseQuietHours(tt.window)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseQuietHours(%q) error = %v, want error %v", tt.window, err, tt.wantErr)
+			}
+			if err == nil && (start != tt.start || end != tt.end) {
+				t.Errorf("parseQuietHours(%q) = %s, %s, want %s, %s", tt.window, start, end, tt.start, tt.end)
+			}
+		})
+	}
+}